@@ -0,0 +1,1454 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"go-chat/internals/adapters/audit"
+	"go-chat/internals/adapters/cache"
+	"go-chat/internals/adapters/mailer"
+	"go-chat/internals/adapters/password"
+	"go-chat/internals/adapters/ratelimit"
+	"go-chat/internals/adapters/repository"
+	"go-chat/internals/adapters/signing"
+	"go-chat/internals/adapters/totp"
+	"go-chat/internals/adapters/webauthn/webauthntest"
+	"go-chat/internals/config"
+	"go-chat/internals/core/domain"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	testEmail    = "alice@example.com"
+	testUsername = "alice"
+	testPassword = "Corr3ct-Horse-Battery"
+)
+
+// TestMain points the configuration at in-process backends and a scratch
+// signing key directory shared by all tests.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "goauth-e2e")
+	if err != nil {
+		panic(err)
+	}
+
+	env := map[string]string{
+		"DATABASE_DRIVER":       "sqlite",
+		"CACHE_DRIVER":          "memory",
+		"MAIL_DRIVER":           "log",
+		"MFA_ENCRYPTION_KEY":    base64.StdEncoding.EncodeToString(make([]byte, 32)),
+		"SIGNING_KEY_DIR":       filepath.Join(dir, "keys"),
+		"SIGNING_KEY_ALGORITHM": "ES256",
+	}
+	for key, value := range env {
+		os.Setenv(key, value)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+type testServer struct {
+	t      *testing.T
+	app    *fiber.App
+	db     *gorm.DB
+	store  *repository.DB
+	outbox *mailer.Outbox
+}
+
+// newTestServer boots the app from InitRoutes against SQLite in memory and the
+// in-memory cache, with a database of its own for each test.
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	config, err := config.Load("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.UseOperationTimeout(db, config.DBTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&domain.User{}, &domain.Book{}, &domain.RecoveryCode{}, &domain.WebAuthnCredential{}, &domain.OAuthClient{}, &domain.Role{}, &domain.Permission{}, &domain.APIKey{}, &domain.AuditEvent{}, &domain.OAuthConsent{}); err != nil {
+		t.Fatal(err)
+	}
+
+	keyRing, err := signing.LoadKeyRing(config.SigningKeyDir, config.SigningKeyAlgorithm, config.SigningKeyGracePeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// bcrypt at its lowest cost keeps the suite fast.
+	hasher, err := password.NewHasher("bcrypt", password.Argon2idParams{
+		Memory:      uint32(config.Argon2Memory),
+		Time:        uint32(config.Argon2Time),
+		Parallelism: uint8(config.Argon2Parallelism),
+	}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &password.Policy{
+		MinLength:           config.PasswordMinLength,
+		MaxLength:           config.PasswordMaxLength,
+		MaxBytes:            hasher.MaxPasswordBytes(),
+		MinCharacterClasses: config.PasswordMinCharacterClasses,
+	}
+
+	memoryCache := cache.NewMemoryCache()
+	t.Cleanup(func() { memoryCache.Close() })
+	store := repository.NewDB(db, memoryCache, keyRing, hasher, policy, config)
+	if err := store.SeedRoles(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	outbox := mailer.NewOutbox()
+	loginLimiter := ratelimit.NewLoginLimiter(memoryCache, ratelimit.Policy{
+		Window:           config.LoginFailureWindow,
+		BackoffAfter:     config.LoginBackoffAfter,
+		BackoffBase:      config.LoginBackoffBase,
+		BackoffMax:       config.LoginBackoffMax,
+		LockoutThreshold: config.LoginLockoutThreshold,
+		LockoutDuration:  config.LoginLockoutDuration,
+		IPLimit:          config.LoginIPFailureLimit,
+	})
+	initServices(store, outbox, loginLimiter, audit.NewPostgresSink(db))
+
+	return &testServer{t: t, app: InitRoutes(config), db: db, store: store, outbox: outbox}
+}
+
+// do sends a request with an optional JSON body and cookies and returns the response.
+func (s *testServer) do(method, path string, body interface{}, cookies ...*http.Cookie) *http.Response {
+	s.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+
+	resp, err := s.app.Test(req, -1)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return resp
+}
+
+// doWithAuthorization sends a request without a body and with the given Authorization header.
+func (s *testServer) doWithAuthorization(method, path, authorization string) *http.Response {
+	s.t.Helper()
+
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set(fiber.HeaderAuthorization, authorization)
+
+	resp, err := s.app.Test(req, -1)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return resp
+}
+
+// register creates the test user and returns its ID.
+func (s *testServer) register() string {
+	s.t.Helper()
+
+	resp := s.do(http.MethodPost, "/api/auth/register", domain.RegisterRequest{
+		Email:    testEmail,
+		Username: testUsername,
+		Password: testPassword,
+	})
+	expectStatus(s.t, resp, http.StatusOK)
+
+	var body struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	decode(s.t, resp, &body)
+	return body.Data.ID
+}
+
+// grantAdmin gives the test user the admin role.
+func (s *testServer) grantAdmin() {
+	s.t.Helper()
+
+	user, err := s.store.GetUserByEmail(context.Background(), testEmail)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if err := s.store.AssignRole(context.Background(), user.ID.String(), domain.RoleAdmin); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// login logs the test user in and returns the access and refresh token cookies.
+func (s *testServer) login() (*http.Cookie, *http.Cookie) {
+	s.t.Helper()
+
+	resp := s.do(http.MethodPost, "/api/auth/login", domain.LoginRequest{Email: testEmail, Password: testPassword})
+	expectStatus(s.t, resp, http.StatusOK)
+	return tokenCookies(s.t, resp)
+}
+
+func tokenCookies(t *testing.T, resp *http.Response) (*http.Cookie, *http.Cookie) {
+	t.Helper()
+
+	var access, refresh *http.Cookie
+	for _, cookie := range resp.Cookies() {
+		switch cookie.Name {
+		case "access_token":
+			access = cookie
+		case "refresh_token":
+			refresh = cookie
+		}
+	}
+	if access == nil || refresh == nil {
+		t.Fatalf("response did not set both token cookies: %v", resp.Cookies())
+	}
+	return access, refresh
+}
+
+func expectStatus(t *testing.T, resp *http.Response, want int) {
+	t.Helper()
+
+	if resp.StatusCode != want {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("%s %s: got status %d, want %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, want, body)
+	}
+}
+
+// expectProblem checks that resp is a problem details response with the given status and code.
+func expectProblem(t *testing.T, resp *http.Response, status int, code string) {
+	t.Helper()
+
+	expectStatus(t, resp, status)
+	if contentType := resp.Header.Get(fiber.HeaderContentType); contentType != "application/problem+json" {
+		t.Fatalf("%s %s: got content type %q, want application/problem+json", resp.Request.Method, resp.Request.URL.Path, contentType)
+	}
+
+	var body struct {
+		Status int    `json:"status"`
+		Code   string `json:"code"`
+	}
+	decode(t, resp, &body)
+	if body.Status != status || body.Code != code {
+		t.Fatalf("%s %s: got problem %d %q, want %d %q", resp.Request.Method, resp.Request.URL.Path, body.Status, body.Code, status, code)
+	}
+}
+
+// postForm sends a form-encoded POST, as OAuth clients do to the token endpoint.
+func (s *testServer) postForm(path string, form url.Values) *http.Response {
+	s.t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+
+	resp, err := s.app.Test(req, -1)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return resp
+}
+
+// waitForMail waits for the outbox to hold n messages, since some are sent after the response.
+func (s *testServer) waitForMail(n int) []mailer.Message {
+	s.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		messages := s.outbox.Messages()
+		if len(messages) >= n {
+			return messages
+		}
+		if time.Now().After(deadline) {
+			s.t.Fatalf("expected %d mails, got %v", n, messages)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// expectOAuthError checks that resp is an RFC 6749 error response with the given status and error code.
+func expectOAuthError(t *testing.T, resp *http.Response, status int, code string) {
+	t.Helper()
+
+	expectStatus(t, resp, status)
+	var body domain.OAuthError
+	decode(t, resp, &body)
+	if body.Code != code {
+		t.Fatalf("%s %s: got error %q, want %q", resp.Request.Method, resp.Request.URL.Path, body.Code, code)
+	}
+}
+
+// auditEvents returns the audit events of the type, as read by the admin logged in with access.
+func (s *testServer) auditEvents(access *http.Cookie, eventType string) []domain.AuditEvent {
+	s.t.Helper()
+
+	resp := s.do(http.MethodGet, "/api/admin/audit?type="+eventType, nil, access)
+	expectStatus(s.t, resp, http.StatusOK)
+	var body struct {
+		Data struct {
+			Events []domain.AuditEvent `json:"events"`
+		} `json:"data"`
+	}
+	decode(s.t, resp, &body)
+	return body.Data.Events
+}
+
+// createOAuthClient registers an OAuth client as the user logged in with access.
+func (s *testServer) createOAuthClient(access *http.Cookie, client domain.CreateOAuthClientRequest) domain.CreateOAuthClientResponse {
+	s.t.Helper()
+
+	resp := s.do(http.MethodPost, "/api/oauth/clients", client, access)
+	expectStatus(s.t, resp, http.StatusCreated)
+	var body struct {
+		Data domain.CreateOAuthClientResponse `json:"data"`
+	}
+	decode(s.t, resp, &body)
+	return body.Data
+}
+
+// authorizationCodeTokens runs the authorization code flow for the user
+// logged in with access, who owns the client and so is not asked to consent.
+func (s *testServer) authorizationCodeTokens(access *http.Cookie, clientID, scope string) domain.TokenResponse {
+	s.t.Helper()
+
+	verifier := strings.Repeat("v", 43)
+	sum := sha256.Sum256([]byte(verifier))
+	resp := s.do(http.MethodGet, "/oauth/authorize?"+url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"scope":                 {scope},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}.Encode(), nil, access)
+	expectStatus(s.t, resp, http.StatusFound)
+	location, err := url.Parse(resp.Header.Get(fiber.HeaderLocation))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	resp = s.postForm("/oauth/token", url.Values{
+		"grant_type":    {domain.GrantTypeAuthorizationCode},
+		"client_id":     {clientID},
+		"code":          {location.Query().Get("code")},
+		"code_verifier": {verifier},
+	})
+	expectStatus(s.t, resp, http.StatusOK)
+	var tokens domain.TokenResponse
+	decode(s.t, resp, &tokens)
+	return tokens
+}
+
+func decode(t *testing.T, resp *http.Response, v interface{}) {
+	t.Helper()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+}
+
+func TestAuthLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	s.register()
+	if messages := s.outbox.Messages(); len(messages) != 1 || messages[0].To != testEmail {
+		t.Fatalf("expected one verification mail to %s, got %v", testEmail, messages)
+	}
+
+	access, refresh := s.login()
+	expectStatus(t, s.do(http.MethodGet, "/api/books", nil, access), http.StatusOK)
+
+	resp := s.do(http.MethodGet, "/api/auth/refresh", nil, refresh)
+	expectStatus(t, resp, http.StatusOK)
+	newAccess, newRefresh := tokenCookies(t, resp)
+	if newRefresh.Value == refresh.Value {
+		t.Fatal("refresh returned the same refresh token")
+	}
+	expectStatus(t, s.do(http.MethodGet, "/api/books", nil, newAccess), http.StatusOK)
+
+	expectStatus(t, s.do(http.MethodGet, "/api/auth/logout", nil, newRefresh), http.StatusOK)
+
+	// Logout revokes the pair, so neither token can be used again.
+	expectProblem(t, s.do(http.MethodGet, "/api/books", nil, newAccess), http.StatusUnauthorized, "access_token_invalid")
+	expectProblem(t, s.do(http.MethodGet, "/api/auth/refresh", nil, newRefresh), http.StatusUnauthorized, "refresh_token_invalid")
+}
+
+func TestRotatedRefreshTokenReuseEndsTheLogin(t *testing.T) {
+	// Without a grace window, any replay of a rotated refresh token counts as reuse.
+	t.Setenv("REFRESH_TOKEN_REUSE_GRACE", "0s")
+
+	s := newTestServer(t)
+	userID := s.register()
+	s.grantAdmin()
+	admin, _ := s.login()
+
+	_, refresh := s.login()
+	resp := s.do(http.MethodGet, "/api/auth/refresh", nil, refresh)
+	expectStatus(t, resp, http.StatusOK)
+	newAccess, newRefresh := tokenCookies(t, resp)
+
+	expectProblem(t, s.do(http.MethodGet, "/api/auth/refresh", nil, refresh), http.StatusUnauthorized, "refresh_token_reused")
+
+	// Replaying the rotated token revokes the whole family, including the tokens that replaced it.
+	expectProblem(t, s.do(http.MethodGet, "/api/books", nil, newAccess), http.StatusUnauthorized, "access_token_invalid")
+	expectProblem(t, s.do(http.MethodGet, "/api/auth/refresh", nil, newRefresh), http.StatusUnauthorized, "refresh_token_invalid")
+
+	// The reuse is audited, and the admin's own login is not affected.
+	if reuses := s.auditEvents(admin, domain.AuditEventRefreshTokenReuse); len(reuses) != 1 || reuses[0].TargetID != userID {
+		t.Fatalf("got reuse events %+v, want one for %s", reuses, userID)
+	}
+}
+
+func TestConcurrentRefreshWithinGraceWindow(t *testing.T) {
+	s := newTestServer(t)
+	s.register()
+
+	_, refresh := s.login()
+
+	// Several clients sharing the login refresh at the same moment, as tabs of one browser do.
+	const clients = 8
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	results := make([]result, clients)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/api/auth/refresh", nil)
+			req.AddCookie(&http.Cookie{Name: refresh.Name, Value: refresh.Value})
+			<-start
+			results[i].resp, results[i].err = s.app.Test(req, -1)
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	var access, newRefresh *http.Cookie
+	for i, result := range results {
+		if result.err != nil {
+			t.Fatal(result.err)
+		}
+		expectStatus(t, result.resp, http.StatusOK)
+		clientAccess, clientRefresh := tokenCookies(t, result.resp)
+		if i == 0 {
+			access, newRefresh = clientAccess, clientRefresh
+		} else if clientAccess.Value != access.Value || clientRefresh.Value != newRefresh.Value {
+			t.Fatal("concurrent refreshes within the grace window returned different tokens")
+		}
+	}
+
+	// Every client holds the surviving pair, so each keeps a working login.
+	expectStatus(t, s.do(http.MethodGet, "/api/books", nil, access), http.StatusOK)
+	for range clients {
+		expectStatus(t, s.do(http.MethodGet, "/api/auth/refresh", nil, newRefresh), http.StatusOK)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	s := newTestServer(t)
+	s.register()
+
+	login := func(device string) (*http.Cookie, *http.Cookie) {
+		t.Helper()
+
+		resp := s.do(http.MethodPost, "/api/auth/login", domain.LoginRequest{Email: testEmail, Password: testPassword, DeviceName: device})
+		expectStatus(t, resp, http.StatusOK)
+		return tokenCookies(t, resp)
+	}
+	sessions := func(access *http.Cookie) map[string]domain.Session {
+		t.Helper()
+
+		resp := s.do(http.MethodGet, "/api/me/sessions", nil, access)
+		expectStatus(t, resp, http.StatusOK)
+		var body struct {
+			Data []domain.Session `json:"data"`
+		}
+		decode(t, resp, &body)
+
+		byDevice := make(map[string]domain.Session, len(body.Data))
+		for _, session := range body.Data {
+			byDevice[session.DeviceLabel] = session
+		}
+		return byDevice
+	}
+
+	laptopAccess, laptopRefresh := login("laptop")
+	_, phoneRefresh := login("phone")
+	_, tabletRefresh := login("tablet")
+
+	listed := sessions(laptopAccess)
+	if len(listed) != 3 || !listed["laptop"].Current || listed["phone"].Current || listed["tablet"].Current {
+		t.Fatalf("got sessions %+v, want laptop, phone and tablet with only the laptop current", listed)
+	}
+
+	// Revoking a session ends its refresh token and nothing else.
+	expectStatus(t, s.do(http.MethodDelete, "/api/me/sessions/"+listed["phone"].ID, nil, laptopAccess), http.StatusOK)
+	expectProblem(t, s.do(http.MethodGet, "/api/auth/refresh", nil, phoneRefresh), http.StatusUnauthorized, "refresh_token_invalid")
+	if listed := sessions(laptopAccess); len(listed) != 2 {
+		t.Fatalf("got sessions %+v after revoking the phone, want laptop and tablet", listed)
+	}
+
+	// Revoking the others keeps the caller logged in.
+	expectStatus(t, s.do(http.MethodDelete, "/api/me/sessions", nil, laptopAccess), http.StatusOK)
+	expectProblem(t, s.do(http.MethodGet, "/api/auth/refresh", nil, tabletRefresh), http.StatusUnauthorized, "refresh_token_invalid")
+	expectStatus(t, s.do(http.MethodGet, "/api/books", nil, laptopAccess), http.StatusOK)
+	resp := s.do(http.MethodGet, "/api/auth/refresh", nil, laptopRefresh)
+	expectStatus(t, resp, http.StatusOK)
+	laptopAccess, _ = tokenCookies(t, resp)
+
+	if listed := sessions(laptopAccess); len(listed) != 1 || !listed["laptop"].Current {
+		t.Fatalf("got sessions %+v after revoking the others, want only the current laptop", listed)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name string
+		// cookie returns the access token cookie to send, or nil for none.
+		cookie func(s *testServer, userID string, access, refresh *http.Cookie) *http.Cookie
+		want   int
+		// code is the problem code expected for an error response.
+		code string
+	}{
+		{
+			name: "valid token",
+			cookie: func(s *testServer, userID string, access, refresh *http.Cookie) *http.Cookie {
+				return access
+			},
+			want: http.StatusOK,
+		},
+		{
+			name: "missing cookie",
+			cookie: func(s *testServer, userID string, access, refresh *http.Cookie) *http.Cookie {
+				return nil
+			},
+			want: http.StatusUnauthorized,
+			code: "authentication_required",
+		},
+		{
+			name: "bad signature",
+			cookie: func(s *testServer, userID string, access, refresh *http.Cookie) *http.Cookie {
+				return &http.Cookie{Name: access.Name, Value: tamperSignature(access.Value)}
+			},
+			want: http.StatusUnauthorized,
+			code: "token_invalid",
+		},
+		{
+			name: "revoked jti",
+			cookie: func(s *testServer, userID string, access, refresh *http.Cookie) *http.Cookie {
+				expectStatus(s.t, s.do(http.MethodGet, "/api/auth/logout", nil, refresh), http.StatusOK)
+				return access
+			},
+			want: http.StatusUnauthorized,
+			code: "access_token_invalid",
+		},
+		{
+			name: "deleted user",
+			cookie: func(s *testServer, userID string, access, refresh *http.Cookie) *http.Cookie {
+				if err := s.db.Exec("DELETE FROM users WHERE id = ?", userID).Error; err != nil {
+					s.t.Fatal(err)
+				}
+				return access
+			},
+			want: http.StatusUnauthorized,
+			code: "access_token_invalid",
+		},
+		{
+			name: "refresh token as access token",
+			cookie: func(s *testServer, userID string, access, refresh *http.Cookie) *http.Cookie {
+				return &http.Cookie{Name: access.Name, Value: refresh.Value}
+			},
+			want: http.StatusUnauthorized,
+			code: "token_invalid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			userID := s.register()
+			access, refresh := s.login()
+
+			var cookies []*http.Cookie
+			if cookie := tt.cookie(s, userID, access, refresh); cookie != nil {
+				cookies = append(cookies, cookie)
+			}
+			resp := s.do(http.MethodGet, "/api/books", nil, cookies...)
+			if tt.code == "" {
+				expectStatus(t, resp, tt.want)
+				return
+			}
+			expectProblem(t, resp, tt.want, tt.code)
+		})
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	s := newTestServer(t)
+	s.register()
+
+	resp := s.do(http.MethodPost, "/api/auth/register", domain.RegisterRequest{
+		Email:    testEmail,
+		Username: "bob",
+		Password: testPassword,
+	})
+	expectProblem(t, resp, http.StatusConflict, "email_taken")
+
+	resp = s.do(http.MethodPost, "/api/auth/register", domain.RegisterRequest{
+		Email:    "bob@example.com",
+		Username: "bob",
+		Password: "short",
+	})
+	expectProblem(t, resp, http.StatusBadRequest, "password_policy")
+
+	// bcrypt cannot hash more than 72 bytes, which 40 characters reach when most take two.
+	resp = s.do(http.MethodPost, "/api/auth/register", domain.RegisterRequest{
+		Email:    "bob@example.com",
+		Username: "bob",
+		Password: strings.Repeat("ü", 37) + "Ab1",
+	})
+	expectProblem(t, resp, http.StatusBadRequest, "password_policy")
+
+	resp = s.do(http.MethodPost, "/api/auth/login", domain.LoginRequest{Email: testEmail, Password: "wrong password"})
+	expectProblem(t, resp, http.StatusUnauthorized, "invalid_credentials")
+
+	expectProblem(t, s.do(http.MethodGet, "/api/auth/refresh", nil), http.StatusUnauthorized, "refresh_token_missing")
+	expectProblem(t, s.do(http.MethodGet, "/api/no-such-route", nil), http.StatusNotFound, "not_found")
+}
+
+func TestLoginFailuresLookAlike(t *testing.T) {
+	s := newTestServer(t)
+	s.register()
+
+	// The limiter counts failures per email, so each attempt stays below the backoff threshold.
+	unknown := s.do(http.MethodPost, "/api/auth/login", domain.LoginRequest{Email: "nobody@example.com", Password: testPassword})
+	expectStatus(t, unknown, http.StatusUnauthorized)
+	wrong := s.do(http.MethodPost, "/api/auth/login", domain.LoginRequest{Email: testEmail, Password: "wrong password"})
+	expectStatus(t, wrong, http.StatusUnauthorized)
+
+	unknownBody, _ := io.ReadAll(unknown.Body)
+	wrongBody, _ := io.ReadAll(wrong.Body)
+	if string(unknownBody) != string(wrongBody) {
+		t.Fatalf("login failures differ:\nunknown email:  %s\nwrong password: %s", unknownBody, wrongBody)
+	}
+}
+
+func TestLockoutAndUnlockAreAudited(t *testing.T) {
+	t.Setenv("LOGIN_BACKOFF_AFTER", "100")
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "3")
+
+	s := newTestServer(t)
+	userID := s.register()
+	s.grantAdmin()
+	access, _ := s.login()
+
+	wrong := domain.LoginRequest{Email: testEmail, Password: "not-" + testPassword}
+	for i := 0; i < 3; i++ {
+		expectStatus(t, s.do(http.MethodPost, "/api/auth/login", wrong), http.StatusUnauthorized)
+	}
+	right := domain.LoginRequest{Email: testEmail, Password: testPassword}
+	expectStatus(t, s.do(http.MethodPost, "/api/auth/login", right), http.StatusTooManyRequests)
+
+	expectStatus(t, s.do(http.MethodPost, "/api/admin/users/"+userID+"/unlock", nil, access), http.StatusOK)
+	expectStatus(t, s.do(http.MethodPost, "/api/auth/login", right), http.StatusOK)
+
+	locks := s.auditEvents(access, domain.AuditEventAccountLockout)
+	if len(locks) != 1 || locks[0].TargetID != userID || locks[0].ActorID != "" {
+		t.Fatalf("got lockout events %+v, want one for %s without an actor", locks, userID)
+	}
+	unlocks := s.auditEvents(access, domain.AuditEventAccountUnlock)
+	if len(unlocks) != 1 || unlocks[0].TargetID != userID || unlocks[0].ActorID != userID || unlocks[0].Outcome != domain.AuditOutcomeSuccess {
+		t.Fatalf("got unlock events %+v, want one by and for %s", unlocks, userID)
+	}
+}
+
+func TestEnumerationSafeRegistration(t *testing.T) {
+	t.Setenv("ENUMERATION_SAFE_REGISTRATION", "true")
+
+	s := newTestServer(t)
+	register := func(email, username string) string {
+		t.Helper()
+
+		resp := s.do(http.MethodPost, "/api/auth/register", domain.RegisterRequest{
+			Email:    email,
+			Username: username,
+			Password: testPassword,
+		})
+		expectStatus(t, resp, http.StatusAccepted)
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	created := register(testEmail, testUsername)
+	if taken := register(testEmail, "bob"); taken != created {
+		t.Fatalf("registering a taken email answered %s, a new account %s", taken, created)
+	}
+	if taken := register("bob@example.com", testUsername); taken != created {
+		t.Fatalf("registering a taken username answered %s, a new account %s", taken, created)
+	}
+
+	// Only the owner of each address learns what happened.
+	messages := s.outbox.Messages()
+	if len(messages) != 3 {
+		t.Fatalf("expected 3 mails, got %v", messages)
+	}
+	for i, want := range []struct{ to, subject string }{
+		{testEmail, "Verify your email address"},
+		{testEmail, "Someone tried to register with your email address"},
+		{"bob@example.com", "Choose another username"},
+	} {
+		if messages[i].To != want.to || messages[i].Subject != want.subject {
+			t.Errorf("mail %d: got %q to %s, want %q to %s", i, messages[i].Subject, messages[i].To, want.subject, want.to)
+		}
+	}
+
+	s.login()
+}
+
+func TestEmailVerification(t *testing.T) {
+	t.Setenv("REQUIRE_EMAIL_VERIFICATION", "true")
+
+	s := newTestServer(t)
+	s.register()
+	s.waitForMail(1)
+
+	login := domain.LoginRequest{Email: testEmail, Password: testPassword}
+	expectProblem(t, s.do(http.MethodPost, "/api/auth/login", login), http.StatusForbidden, "email_not_verified")
+
+	// An unknown email is answered the same way and sends nothing.
+	expectStatus(t, s.do(http.MethodPost, "/api/auth/resend-verification", domain.ResendVerificationRequest{Email: "nobody@example.com"}), http.StatusOK)
+	expectStatus(t, s.do(http.MethodPost, "/api/auth/resend-verification", domain.ResendVerificationRequest{Email: testEmail}), http.StatusOK)
+
+	messages := s.waitForMail(2)
+	for _, message := range messages {
+		if message.To != testEmail || message.Subject != "Verify your email address" {
+			t.Fatalf("expected verification mails to %s only, got %v", testEmail, messages)
+		}
+	}
+	token := strings.TrimSpace(strings.Split(messages[1].Body, "\n\n")[2])
+
+	expectStatus(t, s.do(http.MethodPost, "/api/auth/verify-email", domain.VerifyEmailRequest{Token: token}), http.StatusOK)
+	expectProblem(t, s.do(http.MethodPost, "/api/auth/verify-email", domain.VerifyEmailRequest{Token: token}), http.StatusUnauthorized, "token_used")
+
+	expectStatus(t, s.do(http.MethodPost, "/api/auth/login", login), http.StatusOK)
+}
+
+func TestPasswordReset(t *testing.T) {
+	s := newTestServer(t)
+	s.register()
+	s.waitForMail(1)
+	access, refresh := s.login()
+
+	// An unknown email is answered the same way and sends nothing.
+	unknown := s.do(http.MethodPost, "/api/auth/forgot-password", domain.ForgotPasswordRequest{Email: "nobody@example.com"})
+	expectStatus(t, unknown, http.StatusOK)
+	known := s.do(http.MethodPost, "/api/auth/forgot-password", domain.ForgotPasswordRequest{Email: testEmail})
+	expectStatus(t, known, http.StatusOK)
+
+	unknownBody, _ := io.ReadAll(unknown.Body)
+	knownBody, _ := io.ReadAll(known.Body)
+	if string(unknownBody) != string(knownBody) {
+		t.Fatalf("forgot password answers differ:\nunknown email: %s\nknown email:   %s", unknownBody, knownBody)
+	}
+
+	messages := s.waitForMail(2)
+	if len(messages) != 2 || messages[1].To != testEmail || messages[1].Subject != "Reset your password" {
+		t.Fatalf("expected one reset mail to %s, got %v", testEmail, messages[1:])
+	}
+	token := strings.Split(messages[1].Body, "\n\n")[2]
+
+	newPassword := "N3w-Horse-Battery-Staple"
+	expectStatus(t, s.do(http.MethodPost, "/api/auth/reset-password", domain.ResetPasswordRequest{Token: token, Password: newPassword}), http.StatusOK)
+	expectProblem(t, s.do(http.MethodPost, "/api/auth/reset-password", domain.ResetPasswordRequest{Token: token, Password: newPassword}),
+		http.StatusUnauthorized, "token_used")
+
+	// The reset ends every login made with the old password.
+	expectProblem(t, s.do(http.MethodGet, "/api/books", nil, access), http.StatusUnauthorized, "access_token_invalid")
+	expectProblem(t, s.do(http.MethodGet, "/api/auth/refresh", nil, refresh), http.StatusUnauthorized, "refresh_token_invalid")
+
+	resp := s.do(http.MethodPost, "/api/auth/login", domain.LoginRequest{Email: testEmail, Password: newPassword})
+	expectStatus(t, resp, http.StatusOK)
+	newAccess, _ := tokenCookies(t, resp)
+
+	var sessions struct {
+		Data []domain.Session `json:"data"`
+	}
+	resp = s.do(http.MethodGet, "/api/me/sessions", nil, newAccess)
+	expectStatus(t, resp, http.StatusOK)
+	decode(t, resp, &sessions)
+	if len(sessions.Data) != 1 {
+		t.Fatalf("expected only the login after the reset, got sessions %+v", sessions.Data)
+	}
+}
+
+func TestPasskeys(t *testing.T) {
+	s := newTestServer(t)
+	s.register()
+	access, _ := s.login()
+
+	config, err := config.Load("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator := webauthntest.NewAuthenticator(config.WebAuthnRPID, config.WebAuthnOrigins[0])
+
+	var creation struct {
+		Data struct {
+			PublicKey domain.PublicKeyCredentialCreationOptions `json:"publicKey"`
+		} `json:"data"`
+	}
+	resp := s.do(http.MethodPost, "/api/auth/passkeys/register/begin", nil, access)
+	expectStatus(t, resp, http.StatusOK)
+	decode(t, resp, &creation)
+
+	credential, err := authenticator.Register(&creation.Data.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, s.do(http.MethodPost, "/api/auth/passkeys/register/finish",
+		domain.PasskeyRegistrationRequest{Name: "laptop", Credential: *credential}, access), http.StatusOK)
+
+	// A registration challenge is single use.
+	expectProblem(t, s.do(http.MethodPost, "/api/auth/passkeys/register/finish",
+		domain.PasskeyRegistrationRequest{Name: "laptop", Credential: *credential}, access), http.StatusUnauthorized, "challenge_invalid")
+
+	beginLogin := func() *domain.PublicKeyCredentialRequestOptions {
+		t.Helper()
+
+		var request struct {
+			Data struct {
+				PublicKey domain.PublicKeyCredentialRequestOptions `json:"publicKey"`
+			} `json:"data"`
+		}
+		resp := s.do(http.MethodPost, "/api/auth/passkeys/login/begin", nil)
+		expectStatus(t, resp, http.StatusOK)
+		decode(t, resp, &request)
+		if len(request.Data.PublicKey.AllowCredentials) != 0 {
+			t.Fatalf("login options list credentials: %v", request.Data.PublicKey.AllowCredentials)
+		}
+		return &request.Data.PublicKey
+	}
+	finishLogin := func(authenticator *webauthntest.Authenticator, options *domain.PublicKeyCredentialRequestOptions) *http.Response {
+		t.Helper()
+
+		assertion, err := authenticator.Login(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.do(http.MethodPost, "/api/auth/passkeys/login/finish", assertion)
+	}
+
+	// A copy of the authenticator made now lags behind once the original is used again.
+	clone := authenticator.Clone()
+
+	resp = finishLogin(authenticator, beginLogin())
+	expectStatus(t, resp, http.StatusOK)
+	passkeyAccess, _ := tokenCookies(t, resp)
+	expectStatus(t, s.do(http.MethodGet, "/api/books", nil, passkeyAccess), http.StatusOK)
+
+	// An assertion signed over a challenge the server never issued is rejected.
+	options := beginLogin()
+	forged := *options
+	forged.Challenge = append(domain.Base64URL{}, options.Challenge...)
+	forged.Challenge[0] ^= 0xff
+	expectProblem(t, finishLogin(authenticator, &forged), http.StatusUnauthorized, "challenge_invalid")
+
+	// The clone's signature counter does not go past the stored one.
+	expectProblem(t, finishLogin(clone, beginLogin()), http.StatusUnauthorized, "passkey_rejected")
+
+	expectStatus(t, finishLogin(authenticator, beginLogin()), http.StatusOK)
+}
+
+func TestMFA(t *testing.T) {
+	t.Setenv("LOGIN_BACKOFF_AFTER", "100")
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "3")
+
+	s := newTestServer(t)
+	userID := s.register()
+	s.grantAdmin()
+	access, _ := s.login()
+
+	var enrollment struct {
+		Data domain.TOTPEnrollment `json:"data"`
+	}
+	resp := s.do(http.MethodPost, "/api/auth/mfa/enroll", nil, access)
+	expectStatus(t, resp, http.StatusOK)
+	decode(t, resp, &enrollment)
+
+	code := func(at time.Time) string {
+		t.Helper()
+
+		code, err := totp.GenerateCode(enrollment.Data.Secret, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	confirmCode := code(time.Now())
+	var confirmation struct {
+		Data struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		} `json:"data"`
+	}
+	resp = s.do(http.MethodPost, "/api/auth/mfa/confirm", domain.MFACodeRequest{Code: confirmCode}, access)
+	expectStatus(t, resp, http.StatusOK)
+	decode(t, resp, &confirmation)
+	recoveryCodes := confirmation.Data.RecoveryCodes
+	if len(recoveryCodes) == 0 {
+		t.Fatal("confirming two-factor authentication returned no recovery codes")
+	}
+
+	challenge := func() string {
+		t.Helper()
+
+		resp := s.do(http.MethodPost, "/api/auth/login", domain.LoginRequest{Email: testEmail, Password: testPassword})
+		expectStatus(t, resp, http.StatusOK)
+		if len(resp.Cookies()) != 0 {
+			t.Fatalf("the password alone set cookies: %v", resp.Cookies())
+		}
+		var body struct {
+			Data domain.LoginResponse `json:"data"`
+		}
+		decode(t, resp, &body)
+		if !body.Data.MFARequired || body.Data.MFAToken == "" {
+			t.Fatalf("got %+v, want a two-factor challenge", body.Data)
+		}
+		return body.Data.MFAToken
+	}
+	verify := func(mfaToken, code string) *http.Response {
+		t.Helper()
+		return s.do(http.MethodPost, "/api/auth/mfa/verify", domain.MFAVerifyRequest{MFAToken: mfaToken, Code: code})
+	}
+
+	// A wrong code uses up the challenge, so each guess takes the password again.
+	mfaToken := challenge()
+	expectProblem(t, verify(mfaToken, "wrong-code"), http.StatusUnauthorized, "mfa_code_invalid")
+	expectProblem(t, verify(mfaToken, recoveryCodes[0]), http.StatusUnauthorized, "token_used")
+
+	// A code is accepted once, even within its validity window.
+	expectProblem(t, verify(challenge(), confirmCode), http.StatusUnauthorized, "mfa_code_invalid")
+	resp = verify(challenge(), code(time.Now().Add(30*time.Second)))
+	expectStatus(t, resp, http.StatusOK)
+	mfaAccess, _ := tokenCookies(t, resp)
+	expectStatus(t, s.do(http.MethodGet, "/api/books", nil, mfaAccess), http.StatusOK)
+
+	// So is a recovery code.
+	expectStatus(t, verify(challenge(), recoveryCodes[0]), http.StatusOK)
+	expectProblem(t, verify(challenge(), recoveryCodes[0]), http.StatusUnauthorized, "mfa_code_invalid")
+
+	// Wrong codes count towards the lockout like wrong passwords.
+	expectProblem(t, verify(challenge(), "wrong-code"), http.StatusUnauthorized, "mfa_code_invalid")
+	expectProblem(t, verify(challenge(), "wrong-code"), http.StatusUnauthorized, "mfa_code_invalid")
+	expectStatus(t, s.do(http.MethodPost, "/api/auth/login", domain.LoginRequest{Email: testEmail, Password: testPassword}), http.StatusTooManyRequests)
+	expectStatus(t, s.do(http.MethodPost, "/api/admin/users/"+userID+"/unlock", nil, access), http.StatusOK)
+
+	expectProblem(t, s.do(http.MethodPost, "/api/auth/mfa/disable", domain.MFACodeRequest{Code: "wrong-code"}, access),
+		http.StatusUnauthorized, "mfa_code_invalid")
+	expectStatus(t, s.do(http.MethodPost, "/api/auth/mfa/disable", domain.MFACodeRequest{Code: recoveryCodes[1]}, access), http.StatusOK)
+	s.login()
+}
+
+func TestOAuthAuthorizationCode(t *testing.T) {
+	s := newTestServer(t)
+	s.register()
+	owner, _ := s.login()
+
+	// Registering clients takes a permission, since a client can ask any user for access.
+	client := domain.CreateOAuthClientRequest{Name: "Reader", RedirectURIs: []string{"https://client.example/callback"}}
+	expectProblem(t, s.do(http.MethodPost, "/api/oauth/clients", client, owner), http.StatusForbidden, "permission_denied")
+	s.grantAdmin()
+	var created struct {
+		Data domain.CreateOAuthClientResponse `json:"data"`
+	}
+	resp := s.do(http.MethodPost, "/api/oauth/clients", client, owner)
+	expectStatus(t, resp, http.StatusCreated)
+	decode(t, resp, &created)
+	clientID := created.Data.ClientID
+
+	// Bob may write books, but will only let the client read them.
+	resp = s.do(http.MethodPost, "/api/auth/register", domain.RegisterRequest{
+		Email:    "bob@example.com",
+		Username: "bob",
+		Password: testPassword,
+	})
+	expectStatus(t, resp, http.StatusOK)
+	var registered struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	decode(t, resp, &registered)
+	if err := s.store.AssignRole(context.Background(), registered.Data.ID, domain.RoleEditor); err != nil {
+		t.Fatal(err)
+	}
+	resp = s.do(http.MethodPost, "/api/auth/login", domain.LoginRequest{Email: "bob@example.com", Password: testPassword})
+	expectStatus(t, resp, http.StatusOK)
+	bob, _ := tokenCookies(t, resp)
+
+	verifier := strings.Repeat("v", 43)
+	sum := sha256.Sum256([]byte(verifier))
+	request := domain.AuthorizationRequest{
+		ResponseType:        "code",
+		ClientID:            clientID,
+		Scope:               "openid " + domain.PermissionBooksRead,
+		State:               "xyz",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(sum[:]),
+		CodeChallengeMethod: "S256",
+	}
+	authorizeURL := "/oauth/authorize?" + url.Values{
+		"response_type":         {request.ResponseType},
+		"client_id":             {request.ClientID},
+		"scope":                 {request.Scope},
+		"state":                 {request.State},
+		"code_challenge":        {request.CodeChallenge},
+		"code_challenge_method": {request.CodeChallengeMethod},
+	}.Encode()
+
+	// Another user is asked first, and a link cannot answer for them.
+	expectStatus(t, s.do(http.MethodGet, authorizeURL, nil, bob), http.StatusOK)
+	expectStatus(t, s.do(http.MethodGet, authorizeURL+"&consent=approve", nil, bob), http.StatusOK)
+
+	code := func(resp *http.Response) string {
+		t.Helper()
+
+		expectStatus(t, resp, http.StatusFound)
+		location, err := url.Parse(resp.Header.Get(fiber.HeaderLocation))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if location.Query().Get("state") != request.State || location.Query().Get("code") == "" {
+			t.Fatalf("unexpected redirect to %s", location)
+		}
+		return location.Query().Get("code")
+	}
+	request.Consent = domain.ConsentApprove
+	approved := code(s.do(http.MethodPost, "/oauth/authorize", request, bob))
+
+	// Once given, consent is remembered; the client's owner is never asked.
+	remembered := code(s.do(http.MethodGet, authorizeURL, nil, bob))
+	code(s.do(http.MethodGet, authorizeURL, nil, owner))
+
+	exchange := func(code, verifier string) *http.Response {
+		// Neither request names a redirect_uri, so neither has to.
+		return s.postForm("/oauth/token", url.Values{
+			"grant_type":    {domain.GrantTypeAuthorizationCode},
+			"client_id":     {clientID},
+			"code":          {code},
+			"code_verifier": {verifier},
+		})
+	}
+	resp = exchange(remembered, "short")
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	resp = exchange(approved, verifier)
+	expectStatus(t, resp, http.StatusOK)
+	var tokens domain.TokenResponse
+	decode(t, resp, &tokens)
+
+	// The token can do what the scope allows and nothing more.
+	delegated := &http.Cookie{Name: "access_token", Value: tokens.AccessToken}
+	expectStatus(t, s.do(http.MethodGet, "/api/books", nil, delegated), http.StatusOK)
+	resp = s.do(http.MethodGet, "/userinfo", nil, delegated)
+	expectStatus(t, resp, http.StatusOK)
+	var userInfo domain.UserInfo
+	decode(t, resp, &userInfo)
+	if userInfo.Subject != registered.Data.ID || userInfo.Email != "" || userInfo.EmailVerified != nil || userInfo.PreferredUsername != "" {
+		t.Fatalf("got userinfo %+v, want only the subject without the email and profile scopes", userInfo)
+	}
+	expectProblem(t, s.do(http.MethodPost, "/api/books", domain.BookRequest{Title: "Dune"}, delegated), http.StatusForbidden, "permission_denied")
+	expectProblem(t, s.do(http.MethodGet, "/api/me/sessions", nil, delegated), http.StatusForbidden, "user_required")
+}
+
+func TestIDTokenAuthTimeSurvivesRefresh(t *testing.T) {
+	s := newTestServer(t)
+	s.register()
+	loginStarted := time.Now().Unix()
+	_, refresh := s.login()
+	loginEnded := time.Now().Unix()
+
+	// Refreshing issues an access token with a later iat, but the user has not logged in again.
+	time.Sleep(time.Second)
+	resp := s.do(http.MethodGet, "/api/auth/refresh", nil, refresh)
+	expectStatus(t, resp, http.StatusOK)
+	access, _ := tokenCookies(t, resp)
+
+	s.grantAdmin()
+	client := s.createOAuthClient(access, domain.CreateOAuthClientRequest{Name: "Reader", RedirectURIs: []string{"https://client.example/callback"}})
+	tokens := s.authorizationCodeTokens(access, client.ClientID, "openid email")
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.Split(tokens.IDToken, ".")[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims domain.IDTokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.AuthTime < loginStarted || claims.AuthTime > loginEnded {
+		t.Fatalf("got auth_time %d, want the login between %d and %d", claims.AuthTime, loginStarted, loginEnded)
+	}
+	if claims.Email != testEmail || claims.EmailVerified == nil || claims.PreferredUsername != "" {
+		t.Fatalf("got claims %+v, want the email claims and no profile claims for the openid email scope", claims)
+	}
+
+	// userinfo answers with the same claims.
+	resp = s.doWithAuthorization(http.MethodGet, "/userinfo", "Bearer "+tokens.AccessToken)
+	expectStatus(t, resp, http.StatusOK)
+	var userInfo domain.UserInfo
+	decode(t, resp, &userInfo)
+	if userInfo.Email != testEmail || userInfo.EmailVerified == nil || userInfo.PreferredUsername != "" {
+		t.Fatalf("got userinfo %+v, want the email claims and no profile claims for the openid email scope", userInfo)
+	}
+}
+
+func TestOAuthClientCredentials(t *testing.T) {
+	s := newTestServer(t)
+	s.register()
+	s.grantAdmin()
+	access, _ := s.login()
+
+	client := s.createOAuthClient(access, domain.CreateOAuthClientRequest{
+		Name:         "Indexer",
+		Confidential: true,
+		GrantTypes:   []string{domain.GrantTypeClientCredentials},
+		Scopes:       []string{domain.PermissionBooksRead, domain.PermissionBooksWrite},
+	})
+	token := func(secret, scope string) *http.Response {
+		return s.postForm("/oauth/token", url.Values{
+			"grant_type":    {domain.GrantTypeClientCredentials},
+			"client_id":     {client.ClientID},
+			"client_secret": {secret},
+			"scope":         {scope},
+		})
+	}
+
+	expectOAuthError(t, token("", ""), http.StatusUnauthorized, "invalid_client")
+	expectOAuthError(t, token(client.ClientSecret+"x", ""), http.StatusUnauthorized, "invalid_client")
+	expectOAuthError(t, token(client.ClientSecret, domain.PermissionAuditRead), http.StatusBadRequest, "invalid_scope")
+
+	// Without a scope the client gets every registered one.
+	resp := token(client.ClientSecret, "")
+	expectStatus(t, resp, http.StatusOK)
+	var tokens domain.TokenResponse
+	decode(t, resp, &tokens)
+	if tokens.Scope != domain.PermissionBooksRead+" "+domain.PermissionBooksWrite || tokens.RefreshToken != "" {
+		t.Fatalf("got %+v, want every registered scope and no refresh token", tokens)
+	}
+
+	// A narrower scope limits the token to it.
+	resp = token(client.ClientSecret, domain.PermissionBooksRead)
+	expectStatus(t, resp, http.StatusOK)
+	decode(t, resp, &tokens)
+	if tokens.Scope != domain.PermissionBooksRead {
+		t.Fatalf("got scope %q, want %q", tokens.Scope, domain.PermissionBooksRead)
+	}
+	bearer := "Bearer " + tokens.AccessToken
+	expectStatus(t, s.doWithAuthorization(http.MethodGet, "/api/books", bearer), http.StatusOK)
+	expectProblem(t, s.doWithAuthorization(http.MethodPost, "/api/books", bearer), http.StatusForbidden, "permission_denied")
+	expectProblem(t, s.doWithAuthorization(http.MethodGet, "/userinfo", bearer), http.StatusForbidden, "user_required")
+}
+
+func TestOAuthIntrospection(t *testing.T) {
+	t.Setenv("OIDC_ISSUER", "https://auth.example/")
+	t.Setenv("ACCESS_TOKEN_EXPIRED_IN", "1s")
+
+	s := newTestServer(t)
+	userID := s.register()
+	s.grantAdmin()
+	expiring, _ := s.login()
+
+	resourceServer := s.createOAuthClient(expiring, domain.CreateOAuthClientRequest{
+		Name:         "Resource server",
+		Confidential: true,
+		GrantTypes:   []string{domain.GrantTypeClientCredentials},
+		Scopes:       []string{domain.PermissionBooksRead},
+	})
+	public := s.createOAuthClient(expiring, domain.CreateOAuthClientRequest{Name: "Reader", RedirectURIs: []string{"https://client.example/callback"}})
+
+	resp := s.do(http.MethodGet, "/.well-known/openid-configuration", nil)
+	expectStatus(t, resp, http.StatusOK)
+	var discovery domain.OpenIDConfiguration
+	decode(t, resp, &discovery)
+
+	introspect := func(token, hint string) domain.IntrospectionResponse {
+		t.Helper()
+
+		resp := s.postForm("/oauth/introspect", url.Values{
+			"token":           {token},
+			"token_type_hint": {hint},
+			"client_id":       {resourceServer.ClientID},
+			"client_secret":   {resourceServer.ClientSecret},
+		})
+		expectStatus(t, resp, http.StatusOK)
+		var introspection domain.IntrospectionResponse
+		decode(t, resp, &introspection)
+		return introspection
+	}
+
+	// Public clients have no secret to prove who is asking.
+	expectOAuthError(t, s.postForm("/oauth/introspect", url.Values{"token": {expiring.Value}, "client_id": {public.ClientID}}),
+		http.StatusUnauthorized, "invalid_client")
+
+	access, refresh := s.login()
+	if got := introspect(access.Value, ""); !got.Active || got.TokenType != domain.TokenTypeAccessToken || got.Subject != userID || got.Issuer != discovery.Issuer {
+		t.Fatalf("got %+v, want an active access token of %s issued by %s", got, userID, discovery.Issuer)
+	}
+	if got := introspect(refresh.Value, domain.TokenTypeRefreshToken); !got.Active || got.TokenType != domain.TokenTypeRefreshToken || got.Issuer != discovery.Issuer {
+		t.Fatalf("got %+v, want an active refresh token issued by %s", got, discovery.Issuer)
+	}
+
+	resp = s.postForm("/oauth/token", url.Values{
+		"grant_type":    {domain.GrantTypeClientCredentials},
+		"client_id":     {resourceServer.ClientID},
+		"client_secret": {resourceServer.ClientSecret},
+	})
+	expectStatus(t, resp, http.StatusOK)
+	var tokens domain.TokenResponse
+	decode(t, resp, &tokens)
+	if got := introspect(tokens.AccessToken, ""); !got.Active || got.ClientID != resourceServer.ClientID || got.Issuer != discovery.Issuer {
+		t.Fatalf("got %+v, want an active token of client %s issued by %s", got, resourceServer.ClientID, discovery.Issuer)
+	}
+
+	// Revoked and expired tokens are inactive, and nothing else is said about them.
+	expectStatus(t, s.do(http.MethodGet, "/api/auth/logout", nil, refresh), http.StatusOK)
+	for _, token := range []string{access.Value, refresh.Value, "not a token"} {
+		if got := introspect(token, ""); got != (domain.IntrospectionResponse{}) {
+			t.Fatalf("got %+v for a revoked token, want only active false", got)
+		}
+	}
+
+	time.Sleep(2 * time.Second)
+	if got := introspect(expiring.Value, ""); got != (domain.IntrospectionResponse{}) {
+		t.Fatalf("got %+v for an expired token, want only active false", got)
+	}
+}
+
+func TestOAuthRevocation(t *testing.T) {
+	s := newTestServer(t)
+	s.register()
+	s.grantAdmin()
+	access, _ := s.login()
+
+	reader := s.createOAuthClient(access, domain.CreateOAuthClientRequest{Name: "Reader", RedirectURIs: []string{"https://reader.example/callback"}})
+	other := s.createOAuthClient(access, domain.CreateOAuthClientRequest{Name: "Other", RedirectURIs: []string{"https://other.example/callback"}})
+
+	revoke := func(clientID, token, hint string) *http.Response {
+		return s.postForm("/oauth/revoke", url.Values{"client_id": {clientID}, "token": {token}, "token_type_hint": {hint}})
+	}
+	refresh := func(token string) *http.Response {
+		return s.postForm("/oauth/token", url.Values{
+			"grant_type":    {domain.GrantTypeRefreshToken},
+			"client_id":     {reader.ClientID},
+			"refresh_token": {token},
+		})
+	}
+
+	// Revoking the refresh token also revokes the access token issued with it.
+	tokens := s.authorizationCodeTokens(access, reader.ClientID, domain.PermissionBooksRead)
+	expectStatus(t, revoke(reader.ClientID, tokens.RefreshToken, domain.TokenTypeRefreshToken), http.StatusOK)
+	expectProblem(t, s.doWithAuthorization(http.MethodGet, "/api/books", "Bearer "+tokens.AccessToken), http.StatusUnauthorized, "access_token_invalid")
+	expectOAuthError(t, refresh(tokens.RefreshToken), http.StatusBadRequest, "invalid_grant")
+
+	// And the other way around, even with the wrong hint.
+	tokens = s.authorizationCodeTokens(access, reader.ClientID, domain.PermissionBooksRead)
+	expectStatus(t, revoke(reader.ClientID, tokens.AccessToken, domain.TokenTypeRefreshToken), http.StatusOK)
+	expectProblem(t, s.doWithAuthorization(http.MethodGet, "/api/books", "Bearer "+tokens.AccessToken), http.StatusUnauthorized, "access_token_invalid")
+	expectOAuthError(t, refresh(tokens.RefreshToken), http.StatusBadRequest, "invalid_grant")
+
+	// Another client cannot revoke the tokens.
+	tokens = s.authorizationCodeTokens(access, reader.ClientID, domain.PermissionBooksRead)
+	expectOAuthError(t, revoke(other.ClientID, tokens.AccessToken, ""), http.StatusBadRequest, "unauthorized_client")
+	expectStatus(t, s.doWithAuthorization(http.MethodGet, "/api/books", "Bearer "+tokens.AccessToken), http.StatusOK)
+
+	// Tokens that are unknown or already revoked are not an error.
+	expectStatus(t, revoke(reader.ClientID, "not a token", ""), http.StatusOK)
+	expectStatus(t, revoke(reader.ClientID, tokens.AccessToken, ""), http.StatusOK)
+	expectStatus(t, revoke(reader.ClientID, tokens.AccessToken, ""), http.StatusOK)
+	expectOAuthError(t, refresh(tokens.RefreshToken), http.StatusBadRequest, "invalid_grant")
+}
+
+func TestAPIKeys(t *testing.T) {
+	s := newTestServer(t)
+	userID := s.register()
+
+	// A role that may manage keys but holds no permission beyond that and what every user has.
+	role := domain.Role{Name: "key-manager"}
+	var permission domain.Permission
+	if err := s.db.First(&permission, "name = ?", domain.PermissionAPIKeysManage).Error; err != nil {
+		t.Fatal(err)
+	}
+	role.Permissions = []domain.Permission{permission}
+	if err := s.db.Create(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.store.AssignRole(context.Background(), userID, role.Name); err != nil {
+		t.Fatal(err)
+	}
+	access, _ := s.login()
+
+	resp := s.do(http.MethodPost, "/api/admin/service-accounts", domain.CreateServiceAccountRequest{Username: "ci"}, access)
+	expectStatus(t, resp, http.StatusCreated)
+	var account struct {
+		Data domain.User `json:"data"`
+	}
+	decode(t, resp, &account)
+	keysPath := "/api/admin/service-accounts/" + account.Data.ID.String() + "/api-keys"
+
+	// Managing keys does not let the user hand out permissions they lack.
+	expectProblem(t, s.do(http.MethodPost, keysPath, domain.CreateAPIKeyRequest{Name: "deploy", Scopes: []string{domain.PermissionBooksWrite}}, access), http.StatusForbidden, "permission_denied")
+
+	resp = s.do(http.MethodPost, keysPath, domain.CreateAPIKeyRequest{Name: "deploy", Scopes: []string{domain.PermissionBooksRead}}, access)
+	expectStatus(t, resp, http.StatusCreated)
+	var created struct {
+		Data domain.CreateAPIKeyResponse `json:"data"`
+	}
+	decode(t, resp, &created)
+	apiKey := "ApiKey " + created.Data.Key
+
+	expectStatus(t, s.doWithAuthorization(http.MethodGet, "/api/books", apiKey), http.StatusOK)
+	expectProblem(t, s.doWithAuthorization(http.MethodGet, "/api/me/sessions", apiKey), http.StatusForbidden, "user_required")
+	expectProblem(t, s.doWithAuthorization(http.MethodGet, "/userinfo", apiKey), http.StatusForbidden, "user_required")
+
+	// Only the Bearer scheme carries an access token.
+	expectStatus(t, s.doWithAuthorization(http.MethodGet, "/api/books", "Bearer "+access.Value), http.StatusOK)
+	expectProblem(t, s.doWithAuthorization(http.MethodGet, "/api/books", "Basic "+access.Value), http.StatusUnauthorized, "authentication_required")
+}
+
+func TestBooks(t *testing.T) {
+	s := newTestServer(t)
+	userID := s.register()
+	if err := s.store.AssignRole(context.Background(), userID, domain.RoleEditor); err != nil {
+		t.Fatal(err)
+	}
+	access, _ := s.login()
+
+	var ids []string
+	for _, title := range []string{"Go in Action", "The Go Programming Language", "Programming Rust"} {
+		resp := s.do(http.MethodPost, "/api/books", domain.BookRequest{Title: title}, access)
+		expectStatus(t, resp, http.StatusOK)
+		var body struct {
+			Data domain.Book `json:"data"`
+		}
+		decode(t, resp, &body)
+		ids = append(ids, body.Data.ID.String())
+	}
+
+	type page struct {
+		Data []domain.Book       `json:"data"`
+		Meta domain.BookPageMeta `json:"meta"`
+	}
+	list := func(query string) page {
+		t.Helper()
+
+		resp := s.do(http.MethodGet, "/api/books"+query, nil, access)
+		expectStatus(t, resp, http.StatusOK)
+		var body page
+		decode(t, resp, &body)
+		return body
+	}
+	titles := func(p page) []string {
+		var titles []string
+		for _, book := range p.Data {
+			titles = append(titles, book.Title)
+		}
+		return titles
+	}
+
+	first := list("?limit=2")
+	if first.Meta.Total != 3 || first.Meta.NextCursor == "" || len(first.Data) != 2 {
+		t.Fatalf("first page: got %v with meta %+v", titles(first), first.Meta)
+	}
+	second := list("?limit=2&cursor=" + first.Meta.NextCursor)
+	if got := append(titles(first), titles(second)...); strings.Join(got, ", ") != "Programming Rust, The Go Programming Language, Go in Action" || second.Meta.NextCursor != "" {
+		t.Fatalf("paging newest first: got %v, last cursor %q", got, second.Meta.NextCursor)
+	}
+	if got := titles(list("?sort=created_at&limit=2&offset=2")); len(got) != 1 || got[0] != "Programming Rust" {
+		t.Fatalf("offset page: got %v", got)
+	}
+	if got := list("?title=GO&sort=created_at"); got.Meta.Total != 2 || strings.Join(titles(got), ", ") != "Go in Action, The Go Programming Language" {
+		t.Fatalf("title search: got %v with meta %+v", titles(got), got.Meta)
+	}
+	if got := list("?title=%25"); got.Meta.Total != 0 {
+		t.Fatalf("a %% in the title search matched %v", titles(got))
+	}
+	expectProblem(t, s.do(http.MethodGet, "/api/books?sort=title", nil, access), http.StatusBadRequest, "invalid_input")
+	expectProblem(t, s.do(http.MethodGet, "/api/books?sort=updated_at&cursor="+first.Meta.NextCursor, nil, access), http.StatusBadRequest, "invalid_input")
+
+	newTitle := "Go in Practice"
+	resp := s.do(http.MethodPatch, "/api/books/"+ids[0], domain.BookUpdate{Title: &newTitle}, access)
+	expectStatus(t, resp, http.StatusOK)
+	var updated struct {
+		Data domain.Book `json:"data"`
+	}
+	decode(t, resp, &updated)
+	if updated.Data.Title != newTitle || !updated.Data.UpdatedAt.After(updated.Data.CreatedAt) {
+		t.Fatalf("patch: got %+v", updated.Data)
+	}
+	if got := titles(list("?sort=-updated_at&limit=1")); got[0] != newTitle {
+		t.Fatalf("most recently updated: got %v", got)
+	}
+	expectProblem(t, s.do(http.MethodPut, "/api/books/"+ids[0], domain.BookRequest{}, access), http.StatusBadRequest, "invalid_input")
+
+	expectStatus(t, s.do(http.MethodDelete, "/api/books/"+ids[0], nil, access), http.StatusOK)
+	expectProblem(t, s.do(http.MethodGet, "/api/books/"+ids[0], nil, access), http.StatusNotFound, "book_not_found")
+	expectProblem(t, s.do(http.MethodDelete, "/api/books/"+ids[0], nil, access), http.StatusNotFound, "book_not_found")
+	if got := list(""); got.Meta.Total != 2 {
+		t.Fatalf("deleted book still listed: %v", titles(got))
+	}
+	if got := titles(list("?deleted=true")); len(got) != 1 || got[0] != newTitle {
+		t.Fatalf("deleted books: got %v", got)
+	}
+
+	expectStatus(t, s.do(http.MethodPost, "/api/books/"+ids[0]+"/restore", nil, access), http.StatusOK)
+	expectStatus(t, s.do(http.MethodGet, "/api/books/"+ids[0], nil, access), http.StatusOK)
+	expectProblem(t, s.do(http.MethodPost, "/api/books/"+ids[0]+"/restore", nil, access), http.StatusConflict, "book_not_deleted")
+	expectProblem(t, s.do(http.MethodGet, "/api/books/not-a-uuid", nil, access), http.StatusNotFound, "book_not_found")
+}
+
+// tamperSignature changes one character in the middle of a JWT's signature.
+func tamperSignature(token string) string {
+	i := strings.LastIndex(token, ".") + 10
+	replacement := byte('A')
+	if token[i] == 'A' {
+		replacement = 'B'
+	}
+	return token[:i] + string(replacement) + token[i+1:]
+}
@@ -1,15 +1,27 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"go-chat/internals/adapters/audit"
 	"go-chat/internals/adapters/cache"
 	"go-chat/internals/adapters/handler"
+	"go-chat/internals/adapters/mailer"
+	"go-chat/internals/adapters/password"
+	"go-chat/internals/adapters/ratelimit"
 	"go-chat/internals/adapters/repository"
+	"go-chat/internals/adapters/signing"
 	"go-chat/internals/config"
 	"go-chat/internals/core/domain"
+	"go-chat/internals/core/ports"
 	"go-chat/internals/core/services"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/glebarez/sqlite"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"gorm.io/driver/postgres"
@@ -17,47 +29,168 @@ import (
 )
 
 var (
-	userService *services.UserService
-	bookService *services.BookService
-	authService *services.AuthService
+	userService    *services.UserService
+	bookService    *services.BookService
+	authService    *services.AuthService
+	mfaService     *services.MFAService
+	passkeyService *services.PasskeyService
+	oauthService   *services.OAuthService
+	oidcService    *services.OIDCService
+	sessionService *services.SessionService
+	roleService    *services.RoleService
+	apiKeyService  *services.APIKeyService
+	auditService   *services.AuditService
+)
+
+var (
+	rotateSigningKey = flag.Bool("rotate-signing-key", false, "generate a new active signing key and exit")
+	grantAdmin       = flag.String("grant-admin", "", "give the admin role to the user with this email and exit")
+	configFile       = flag.String("config", os.Getenv("CONFIG_FILE"), "YAML or JSON settings file; environment variables take precedence over it, and it over flags")
 )
 
 func main() {
-	config, err := config.LoadConfig()
+	config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	config, err := config.Load(*configFile, flag.CommandLine)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	keyRing, err := signing.LoadKeyRing(config.SigningKeyDir, config.SigningKeyAlgorithm, config.SigningKeyGracePeriod)
 	if err != nil {
 		panic(err)
 	}
 
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		config.DBHost, config.DBPort, config.DBUser, config.DBPassword, config.DBName)
+	if *rotateSigningKey {
+		key, err := keyRing.Rotate()
+		if err != nil {
+			panic(err)
+		}
+		log.Printf("Rotated signing key, new active key is %s", key.ID)
+		return
+	}
+	reloadKeyRingOnHangup(keyRing)
 
-	db, err := gorm.Open(postgres.Open(connStr))
+	db, err := openDatabase(config)
 	if err != nil {
 		panic(err)
 	}
+	if err := repository.UseOperationTimeout(db, config.DBTimeout); err != nil {
+		panic(err)
+	}
+
+	cacheRepository, err := openCache(config)
+	if err != nil {
+		panic(err)
+	}
+	defer cacheRepository.Close()
+
+	db.AutoMigrate(&domain.User{}, &domain.Book{}, &domain.RecoveryCode{}, &domain.WebAuthnCredential{}, &domain.OAuthClient{}, &domain.Role{}, &domain.Permission{}, &domain.APIKey{}, &domain.AuditEvent{}, &domain.OAuthConsent{})
 
-	redisCache, err := cache.NewRedisCache("127.0.0.1:6379", "")
+	hasher, err := password.NewHasher(config.PasswordHashAlgorithm, password.Argon2idParams{
+		Memory:      uint32(config.Argon2Memory),
+		Time:        uint32(config.Argon2Time),
+		Parallelism: uint8(config.Argon2Parallelism),
+	}, config.BcryptCost)
 	if err != nil {
 		panic(err)
 	}
 
-	db.AutoMigrate(&domain.User{}, &domain.Book{})
+	passwordPolicy := &password.Policy{
+		MinLength:           config.PasswordMinLength,
+		MaxLength:           config.PasswordMaxLength,
+		MaxBytes:            hasher.MaxPasswordBytes(),
+		MinCharacterClasses: config.PasswordMinCharacterClasses,
+	}
+	if config.PasswordBreachedListFile != "" {
+		passwordPolicy.Breached, err = password.LoadBreachedList(config.PasswordBreachedListFile)
+		if err != nil {
+			panic(err)
+		}
+		log.Printf("Checking passwords against the breached password list %s", config.PasswordBreachedListFile)
+	}
+
+	ctx := context.Background()
+	store := repository.NewDB(db, cacheRepository, keyRing, hasher, passwordPolicy, config)
+	if err := store.SeedRoles(ctx); err != nil {
+		panic(err)
+	}
+
+	if *grantAdmin != "" {
+		user, err := store.GetUserByEmail(ctx, *grantAdmin)
+		if err != nil {
+			panic(err)
+		}
+		if err := store.AssignRole(ctx, user.ID.String(), domain.RoleAdmin); err != nil {
+			panic(err)
+		}
+		log.Printf("Granted the admin role to %s", user.Email)
+		return
+	}
+
+	var mailSender ports.Mailer = mailer.NewSMTPMailer(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.MailFrom)
+	if config.MailDriver == "log" {
+		log.Printf("MAIL_DRIVER is log: mail, including the tokens in it, is written to the log instead of being sent")
+		mailSender = mailer.NewLogMailer()
+	}
+
+	loginLimiter := ratelimit.NewLoginLimiter(cacheRepository, ratelimit.Policy{
+		Window:           config.LoginFailureWindow,
+		BackoffAfter:     config.LoginBackoffAfter,
+		BackoffBase:      config.LoginBackoffBase,
+		BackoffMax:       config.LoginBackoffMax,
+		LockoutThreshold: config.LoginLockoutThreshold,
+		LockoutDuration:  config.LoginLockoutDuration,
+		IPLimit:          config.LoginIPFailureLimit,
+	})
+
+	auditSink, err := newAuditSink(config.AuditSinks, config.AuditLogFile, db)
+	if err != nil {
+		panic(err)
+	}
+	defer auditSink.Close()
 
-	store := repository.NewDB(db, redisCache)
+	initServices(store, mailSender, loginLimiter, auditSink)
 
+	app := InitRoutes(config)
+	shutdownOnSignal(app)
+	if err := app.Listen(":" + config.Port); err != nil {
+		log.Fatalf("Error starting server: %v", err)
+	}
+}
+
+// initServices builds the services InitRoutes serves from the given adapters.
+func initServices(store *repository.DB, mailSender ports.Mailer, loginLimiter ports.LoginLimiter, auditSink ports.AuditSink) {
+	auditService = services.NewAuditService(auditSink, store)
 	authService = services.NewAuthService(store)
-	userService = services.NewUserService(store)
+	userService = services.NewUserService(store, mailSender, loginLimiter, auditService)
 	bookService = services.NewBookService(store)
-	InitRoutes()
+	mfaService = services.NewMFAService(store, loginLimiter, auditService)
+	passkeyService = services.NewPasskeyService(store)
+	oauthService = services.NewOAuthService(store, auditService)
+	oidcService = services.NewOIDCService(store)
+	sessionService = services.NewSessionService(store)
+	roleService = services.NewRoleService(store)
+	apiKeyService = services.NewAPIKeyService(store)
 }
 
-func InitRoutes() {
-	app := fiber.New()
+func InitRoutes(config config.Config) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: handler.ErrorHandler})
 	app.Use(cors.New())
+	app.Use(handler.RequestContext(config.RequestTimeout))
 
 	middlewareHandler := handler.NewAuthHandlers(authService)
-	userHandler := handler.NewUserHandlers(userService)
+	userHandler := handler.NewUserHandlers(userService, auditService, config)
 	bookHandler := handler.NewBookHandlers(bookService)
+	mfaHandler := handler.NewMFAHandlers(mfaService, auditService, config)
+	passkeyHandler := handler.NewPasskeyHandlers(passkeyService, auditService, config)
+	oauthHandler := handler.NewOAuthHandlers(oauthService, auditService)
+	oidcHandler := handler.NewOIDCHandlers(oidcService)
+	sessionHandler := handler.NewSessionHandlers(sessionService, auditService)
+	auditHandler := handler.NewAuditHandlers(auditService)
+	roleHandler := handler.NewRoleHandlers(roleService, auditService)
+	apiKeyHandler := handler.NewAPIKeyHandlers(apiKeyService, auditService)
 
 	router := app.Group("/api")
 	authRouter := router.Group("/auth")
@@ -65,12 +198,145 @@ func InitRoutes() {
 	authRouter.Post("/login", userHandler.LoginUser)
 	authRouter.Get("/logout", userHandler.LogoutUser)
 	authRouter.Get("/refresh", userHandler.RefreshTokens)
+	authRouter.Post("/verify-email", userHandler.VerifyEmail)
+	authRouter.Post("/resend-verification", userHandler.ResendVerification)
+	authRouter.Post("/forgot-password", userHandler.ForgotPassword)
+	authRouter.Post("/reset-password", userHandler.ResetPassword)
 
-	router.Get("/books", middlewareHandler.Middleware, bookHandler.GetBooks)
-	router.Post("/books", middlewareHandler.Middleware, bookHandler.CreateBook)
+	mfaRouter := authRouter.Group("/mfa")
+	mfaRouter.Post("/verify", mfaHandler.Verify)
+	mfaRouter.Post("/enroll", middlewareHandler.Middleware, middlewareHandler.RequireUser, mfaHandler.Enroll)
+	mfaRouter.Post("/confirm", middlewareHandler.Middleware, middlewareHandler.RequireUser, mfaHandler.Confirm)
+	mfaRouter.Post("/disable", middlewareHandler.Middleware, middlewareHandler.RequireUser, mfaHandler.Disable)
 
-	err := app.Listen(":8080")
-	if err != nil {
-		log.Fatalf("Error starting server: %v", err)
+	passkeyRouter := authRouter.Group("/passkeys")
+	passkeyRouter.Post("/register/begin", middlewareHandler.Middleware, middlewareHandler.RequireUser, passkeyHandler.BeginRegistration)
+	passkeyRouter.Post("/register/finish", middlewareHandler.Middleware, middlewareHandler.RequireUser, passkeyHandler.FinishRegistration)
+	passkeyRouter.Post("/login/begin", passkeyHandler.BeginLogin)
+	passkeyRouter.Post("/login/finish", passkeyHandler.FinishLogin)
+
+	router.Post("/oauth/clients", middlewareHandler.Middleware, middlewareHandler.RequireUser, middlewareHandler.RequirePermission(domain.PermissionOAuthClientsManage), oauthHandler.CreateClient)
+
+	meRouter := router.Group("/me", middlewareHandler.Middleware, middlewareHandler.RequireUser)
+	meRouter.Get("/sessions", sessionHandler.ListSessions)
+	meRouter.Delete("/sessions/:id", sessionHandler.RevokeSession)
+	meRouter.Delete("/sessions", sessionHandler.RevokeOtherSessions)
+
+	adminRouter := router.Group("/admin", middlewareHandler.Middleware)
+	manageRoles := middlewareHandler.RequirePermission(domain.PermissionRolesManage)
+	adminRouter.Get("/roles", manageRoles, roleHandler.ListRoles)
+	adminRouter.Get("/users/:id/roles", manageRoles, roleHandler.GetUserRoles)
+	adminRouter.Post("/users/:id/roles", manageRoles, roleHandler.AssignRole)
+	adminRouter.Delete("/users/:id/roles/:role", manageRoles, roleHandler.RemoveRole)
+
+	manageAPIKeys := middlewareHandler.RequirePermission(domain.PermissionAPIKeysManage)
+	adminRouter.Post("/service-accounts", manageAPIKeys, apiKeyHandler.CreateServiceAccount)
+	adminRouter.Post("/service-accounts/:id/api-keys", middlewareHandler.RequireUser, manageAPIKeys, apiKeyHandler.CreateAPIKey)
+	adminRouter.Get("/service-accounts/:id/api-keys", manageAPIKeys, apiKeyHandler.ListAPIKeys)
+	adminRouter.Delete("/api-keys/:id", manageAPIKeys, apiKeyHandler.RevokeAPIKey)
+
+	adminRouter.Post("/users/:id/unlock", middlewareHandler.RequirePermission(domain.PermissionUsersUnlock), userHandler.UnlockAccount)
+
+	adminRouter.Get("/audit", middlewareHandler.RequirePermission(domain.PermissionAuditRead), auditHandler.ListEvents)
+
+	readBooks := middlewareHandler.RequirePermission(domain.PermissionBooksRead)
+	writeBooks := middlewareHandler.RequirePermission(domain.PermissionBooksWrite)
+	router.Get("/books", middlewareHandler.Middleware, readBooks, bookHandler.GetBooks)
+	router.Post("/books", middlewareHandler.Middleware, writeBooks, bookHandler.CreateBook)
+	router.Get("/books/:id", middlewareHandler.Middleware, readBooks, bookHandler.GetBook)
+	router.Put("/books/:id", middlewareHandler.Middleware, writeBooks, bookHandler.ReplaceBook)
+	router.Patch("/books/:id", middlewareHandler.Middleware, writeBooks, bookHandler.UpdateBook)
+	router.Delete("/books/:id", middlewareHandler.Middleware, writeBooks, bookHandler.DeleteBook)
+	router.Post("/books/:id/restore", middlewareHandler.Middleware, writeBooks, bookHandler.RestoreBook)
+
+	oauthRouter := app.Group("/oauth")
+	oauthRouter.Get("/authorize", middlewareHandler.Middleware, middlewareHandler.RequireUser, oauthHandler.Authorize)
+	oauthRouter.Post("/authorize", middlewareHandler.Middleware, middlewareHandler.RequireUser, oauthHandler.AnswerConsent)
+	oauthRouter.Post("/token", oauthHandler.Token)
+	oauthRouter.Post("/introspect", oauthHandler.Introspect)
+	oauthRouter.Post("/revoke", oauthHandler.Revoke)
+
+	app.Get("/.well-known/openid-configuration", oidcHandler.Discovery)
+	app.Get("/.well-known/jwks.json", oidcHandler.JWKS)
+	app.Get("/userinfo", middlewareHandler.Middleware, middlewareHandler.RequireUserOrDelegate, oidcHandler.UserInfo)
+	app.Post("/userinfo", middlewareHandler.Middleware, middlewareHandler.RequireUserOrDelegate, oidcHandler.UserInfo)
+
+	return app
+}
+
+// openDatabase connects to the database named by DATABASE_DRIVER.
+func openDatabase(config config.Config) (*gorm.DB, error) {
+	switch config.DatabaseDriver {
+	case "postgres":
+		connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+			config.DBHost, config.DBPort, config.DBUser, config.DBPassword, config.DBName)
+		return gorm.Open(postgres.Open(connStr))
+	case "sqlite":
+		return gorm.Open(sqlite.Open(config.SQLiteDSN))
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", config.DatabaseDriver)
+	}
+}
+
+// openCache connects to the cache named by CACHE_DRIVER.
+func openCache(config config.Config) (ports.CacheRepository, error) {
+	switch config.CacheDriver {
+	case "redis":
+		return cache.NewRedisCache(config.RedisAddr, config.RedisPassword, config.RedisTimeout)
+	case "memory":
+		return cache.NewMemoryCache(), nil
+	default:
+		return nil, fmt.Errorf("unknown cache driver %q", config.CacheDriver)
 	}
 }
+
+// newAuditSink builds the sink named by each entry of AUDIT_SINKS. Only events
+// in the postgres sink can be queried through GET /api/admin/audit.
+func newAuditSink(names []string, logFile string, db *gorm.DB) (audit.MultiSink, error) {
+	var sinks audit.MultiSink
+	for _, name := range names {
+		switch name {
+		case "postgres":
+			sinks = append(sinks, audit.NewPostgresSink(db))
+		case "file":
+			fileSink, err := audit.NewFileSink(logFile)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, fileSink)
+		default:
+			return nil, fmt.Errorf("unknown audit sink %q", name)
+		}
+	}
+	return sinks, nil
+}
+
+// shutdownOnSignal stops the server on SIGINT or SIGTERM once the requests in
+// flight are done, so Listen returns and main closes the audit log and cache.
+func shutdownOnSignal(app *fiber.App) {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		log.Printf("Shutting down")
+		if err := app.Shutdown(); err != nil {
+			log.Printf("Error shutting down: %v", err)
+		}
+	}()
+}
+
+// reloadKeyRingOnHangup re-reads the signing key directory on SIGHUP, so a key
+// rotated with -rotate-signing-key is picked up without a restart.
+func reloadKeyRingOnHangup(keyRing *signing.KeyRing) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if err := keyRing.Reload(); err != nil {
+				log.Printf("Error reloading signing keys: %v", err)
+				continue
+			}
+			log.Printf("Reloaded signing keys, active key is %s", keyRing.Active().ID)
+		}
+	}()
+}
@@ -0,0 +1,35 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"go-chat/internals/core/domain"
+	"go-chat/internals/core/ports"
+	"io"
+)
+
+// MultiSink writes every event to all of its sinks.
+type MultiSink []ports.AuditSink
+
+// Close closes the sinks that hold resources, such as the file of a FileSink.
+func (m MultiSink) Close() error {
+	var errs []error
+	for _, sink := range m {
+		if closer, ok := sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m MultiSink) Write(ctx context.Context, event *domain.AuditEvent) error {
+	var errs []error
+	for _, sink := range m {
+		if err := sink.Write(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,25 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"go-chat/internals/core/domain"
+
+	"gorm.io/gorm"
+)
+
+// PostgresSink stores events in the audit_events table, where GET /api/admin/audit reads them.
+type PostgresSink struct {
+	db *gorm.DB
+}
+
+func NewPostgresSink(db *gorm.DB) *PostgresSink {
+	return &PostgresSink{db: db}
+}
+
+func (s *PostgresSink) Write(ctx context.Context, event *domain.AuditEvent) error {
+	if err := s.db.WithContext(ctx).Create(event).Error; err != nil {
+		return fmt.Errorf("failed to store audit event: %v", err)
+	}
+	return nil
+}
@@ -3,35 +3,49 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go-chat/internals/core/ports"
+	"reflect"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// maxUpdateAttempts bounds how often Update retries when other clients keep changing the key.
+const maxUpdateAttempts = 10
+
 type RedisCache struct {
 	client *redis.Client
+	// timeout bounds each operation, on top of any deadline of the caller's context.
+	timeout time.Duration
 }
 
-func NewRedisCache(addr, password string) (*RedisCache, error) {
+func NewRedisCache(addr, password string, timeout time.Duration) (*RedisCache, error) {
 	client := redis.NewClient(&redis.Options{
 		Addr:     addr,
 		Password: password,
 		DB:       0, // use default DB
 	})
 
-	_, err := client.Ping(context.Background()).Result()
-	if err != nil {
+	c := &RedisCache{client: client, timeout: timeout}
+
+	ctx, cancel := c.withTimeout(context.Background())
+	defer cancel()
+	if _, err := client.Ping(ctx).Result(); err != nil {
 		return nil, fmt.Errorf("failed to connect to Redis: %v", err)
 	}
 
-	return &RedisCache{client: client}, nil
+	return c, nil
 }
 
-func (c *RedisCache) Get(key string, value interface{}) error {
-	data, err := c.client.Get(context.Background(), key).Result()
+func (c *RedisCache) Get(ctx context.Context, key string, value interface{}) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	data, err := c.client.Get(ctx, key).Result()
 	if err == redis.Nil {
-		return fmt.Errorf("cache miss for key %q", key)
+		return fmt.Errorf("%w for key %q", ports.ErrCacheMiss, key)
 	} else if err != nil {
 		return fmt.Errorf("failed to get value for key %q: %v", key, err)
 	}
@@ -43,22 +57,161 @@ func (c *RedisCache) Get(key string, value interface{}) error {
 	return nil
 }
 
-func (c *RedisCache) Set(key string, value interface{}, duration time.Duration) error {
+func (c *RedisCache) Take(ctx context.Context, key string, value interface{}) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	data, err := c.client.GetDel(ctx, key).Result()
+	if err == redis.Nil {
+		return fmt.Errorf("%w for key %q", ports.ErrCacheMiss, key)
+	} else if err != nil {
+		return fmt.Errorf("failed to take value for key %q: %v", key, err)
+	}
+
+	if err := json.Unmarshal([]byte(data), value); err != nil {
+		return fmt.Errorf("failed to unmarshal cache value for key %q: %v", key, err)
+	}
+
+	return nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, value interface{}, duration time.Duration) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
 	data, err := json.Marshal(value)
 	if err != nil {
 		return fmt.Errorf("failed to marshal cache value for key %q: %v", key, err)
 	}
 
-	if err := c.client.Set(context.Background(), key, data, duration).Err(); err != nil {
+	if err := c.client.Set(ctx, key, data, duration).Err(); err != nil {
 		return fmt.Errorf("failed to set value for key %q: %v", key, err)
 	}
 
 	return nil
 }
 
-func (c *RedisCache) Delete(key string) error {
-	if err := c.client.Del(context.Background(), key).Err(); err != nil {
+func (c *RedisCache) SetIfAbsent(ctx context.Context, key string, value interface{}, duration time.Duration) (bool, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal cache value for key %q: %v", key, err)
+	}
+
+	set, err := c.client.SetNX(ctx, key, data, duration).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to set value for key %q: %v", key, err)
+	}
+
+	return set, nil
+}
+
+// Update uses an optimistic transaction: the key is watched while it is read,
+// and the write is discarded and retried if the key changed meanwhile.
+func (c *RedisCache) Update(ctx context.Context, key string, value interface{}, expiration time.Duration, update func() (bool, error)) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	transaction := func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			return fmt.Errorf("%w for key %q", ports.ErrCacheMiss, key)
+		} else if err != nil {
+			return fmt.Errorf("failed to get value for key %q: %v", key, err)
+		}
+
+		if err := decodeAfresh([]byte(data), value); err != nil {
+			return fmt.Errorf("failed to unmarshal cache value for key %q: %v", key, err)
+		}
+
+		changed, err := update()
+		if err != nil || !changed {
+			return err
+		}
+
+		updated, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to marshal cache value for key %q: %v", key, err)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, updated, expiration)
+			return nil
+		})
+		return err
+	}
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		err := c.client.Watch(ctx, transaction, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to update value for key %q: changed by others on every attempt", key)
+}
+
+func (c *RedisCache) Delete(ctx context.Context, key string) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	if err := c.client.Del(ctx, key).Err(); err != nil {
 		return fmt.Errorf("failed to delete value for key %q: %v", key, err)
 	}
 	return nil
 }
+
+func (c *RedisCache) AddToSet(ctx context.Context, key string, member string, expiration time.Duration) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	pipe := c.client.TxPipeline()
+	pipe.SAdd(ctx, key, member)
+	pipe.Expire(ctx, key, expiration)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to add member to set %q: %v", key, err)
+	}
+	return nil
+}
+
+func (c *RedisCache) GetSetMembers(ctx context.Context, key string) ([]string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	members, err := c.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of set %q: %v", key, err)
+	}
+	return members, nil
+}
+
+func (c *RedisCache) RemoveFromSet(ctx context.Context, key string, member string) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	if err := c.client.SRem(ctx, key, member).Err(); err != nil {
+		return fmt.Errorf("failed to remove member from set %q: %v", key, err)
+	}
+	return nil
+}
+
+func (c *RedisCache) Close() error {
+	return c.client.Close()
+}
+
+// decodeAfresh unmarshals data into the zeroed value, so fields left over from
+// an earlier attempt of Update cannot survive into the next.
+func decodeAfresh(data []byte, value interface{}) error {
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Pointer && !v.IsNil() {
+		v.Elem().SetZero()
+	}
+	return json.Unmarshal(data, value)
+}
+
+func (c *RedisCache) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
@@ -0,0 +1,255 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-chat/internals/core/ports"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired entries that nobody reads are dropped.
+const sweepInterval = time.Minute
+
+type memoryEntry struct {
+	value     []byte
+	members   map[string]struct{}
+	expiresAt time.Time
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// MemoryCache keeps entries in process memory with the same semantics as
+// RedisCache, for development and tests. Entries are lost on restart and are
+// not shared between instances. Operations never block, so they ignore their
+// context.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	// stop ends the sweep goroutine; closeOnce lets Close be called more than once.
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewMemoryCache() *MemoryCache {
+	c := &MemoryCache{
+		entries: make(map[string]*memoryEntry),
+		stop:    make(chan struct{}),
+	}
+	go c.sweep()
+	return c
+}
+
+// Close stops dropping expired entries in the background. The cache keeps
+// working, and entries still expire when they are read.
+func (c *MemoryCache) Close() error {
+	c.closeOnce.Do(func() { close(c.stop) })
+	return nil
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string, value interface{}) error {
+	c.mu.Lock()
+	entry := c.lookup(key)
+	c.mu.Unlock()
+
+	if entry == nil {
+		return fmt.Errorf("%w for key %q", ports.ErrCacheMiss, key)
+	}
+	if entry.members != nil {
+		return fmt.Errorf("failed to get value for key %q: key holds a set", key)
+	}
+
+	if err := json.Unmarshal(entry.value, value); err != nil {
+		return fmt.Errorf("failed to unmarshal cache value for key %q: %v", key, err)
+	}
+
+	return nil
+}
+
+func (c *MemoryCache) Take(ctx context.Context, key string, value interface{}) error {
+	c.mu.Lock()
+	entry := c.lookup(key)
+	if entry != nil && entry.members == nil {
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+
+	if entry == nil {
+		return fmt.Errorf("%w for key %q", ports.ErrCacheMiss, key)
+	}
+	if entry.members != nil {
+		return fmt.Errorf("failed to take value for key %q: key holds a set", key)
+	}
+
+	if err := json.Unmarshal(entry.value, value); err != nil {
+		return fmt.Errorf("failed to unmarshal cache value for key %q: %v", key, err)
+	}
+
+	return nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key string, value interface{}, duration time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache value for key %q: %v", key, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = &memoryEntry{value: data, expiresAt: expiresAt(duration)}
+	return nil
+}
+
+func (c *MemoryCache) SetIfAbsent(ctx context.Context, key string, value interface{}, duration time.Duration) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal cache value for key %q: %v", key, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lookup(key) != nil {
+		return false, nil
+	}
+	c.entries[key] = &memoryEntry{value: data, expiresAt: expiresAt(duration)}
+	return true, nil
+}
+
+// Update holds the lock throughout, so concurrent updates of any key run one after the other.
+func (c *MemoryCache) Update(ctx context.Context, key string, value interface{}, expiration time.Duration, update func() (bool, error)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.lookup(key)
+	if entry == nil {
+		return fmt.Errorf("%w for key %q", ports.ErrCacheMiss, key)
+	}
+	if entry.members != nil {
+		return fmt.Errorf("failed to get value for key %q: key holds a set", key)
+	}
+
+	if err := decodeAfresh(entry.value, value); err != nil {
+		return fmt.Errorf("failed to unmarshal cache value for key %q: %v", key, err)
+	}
+
+	changed, err := update()
+	if err != nil || !changed {
+		return err
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache value for key %q: %v", key, err)
+	}
+	c.entries[key] = &memoryEntry{value: data, expiresAt: expiresAt(expiration)}
+	return nil
+}
+
+func (c *MemoryCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	return nil
+}
+
+// AddToSet adds member to the set at key and, like RedisCache, restarts the
+// expiration of the whole set.
+func (c *MemoryCache) AddToSet(ctx context.Context, key string, member string, expiration time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.lookup(key)
+	if entry == nil {
+		entry = &memoryEntry{members: make(map[string]struct{})}
+		c.entries[key] = entry
+	} else if entry.members == nil {
+		return fmt.Errorf("failed to add member to set %q: key holds a value", key)
+	}
+
+	entry.members[member] = struct{}{}
+	entry.expiresAt = expiresAt(expiration)
+	return nil
+}
+
+func (c *MemoryCache) GetSetMembers(ctx context.Context, key string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.lookup(key)
+	if entry == nil {
+		return []string{}, nil
+	}
+	if entry.members == nil {
+		return nil, fmt.Errorf("failed to get members of set %q: key holds a value", key)
+	}
+
+	members := make([]string, 0, len(entry.members))
+	for member := range entry.members {
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+func (c *MemoryCache) RemoveFromSet(ctx context.Context, key string, member string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.lookup(key)
+	if entry == nil {
+		return nil
+	}
+	if entry.members == nil {
+		return fmt.Errorf("failed to remove member from set %q: key holds a value", key)
+	}
+
+	delete(entry.members, member)
+	// Redis deletes a set once its last member is gone.
+	if len(entry.members) == 0 {
+		delete(c.entries, key)
+	}
+	return nil
+}
+
+// lookup returns the live entry at key, dropping it if it has expired. c.mu must be held.
+func (c *MemoryCache) lookup(key string) *memoryEntry {
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if entry.expired(time.Now()) {
+		delete(c.entries, key)
+		return nil
+	}
+	return entry
+}
+
+func (c *MemoryCache) sweep() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case now := <-ticker.C:
+			c.mu.Lock()
+			for key, entry := range c.entries {
+				if entry.expired(now) {
+					delete(c.entries, key)
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// expiresAt turns a Redis-style expiration into a deadline, where zero means the entry never expires.
+func expiresAt(duration time.Duration) time.Time {
+	if duration <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(duration)
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"go-chat/internals/core/domain"
+	"go-chat/internals/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type APIKeyHandler struct {
+	apiKeyService ports.APIKeyService
+	auditService  ports.AuditService
+}
+
+func NewAPIKeyHandlers(apiKeyService ports.APIKeyService, auditService ports.AuditService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+		auditService:  auditService,
+	}
+}
+
+func (h *APIKeyHandler) CreateServiceAccount(c *fiber.Ctx) error {
+	var req domain.CreateServiceAccountRequest
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidRequestBody
+	}
+
+	if req.Username == "" {
+		return domain.ValidationError("username is required")
+	}
+
+	account, err := h.apiKeyService.CreateServiceAccount(c.UserContext(), req.Username)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"status": "success", "data": account})
+}
+
+func (h *APIKeyHandler) CreateAPIKey(c *fiber.Ctx) error {
+	var req domain.CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidRequestBody
+	}
+
+	if req.Name == "" {
+		return domain.ValidationError("name is required")
+	}
+
+	apiKey, err := h.apiKeyService.CreateAPIKey(c.UserContext(), currentUser(c).ID.String(), c.Params("id"), req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"status": "success", "data": apiKey})
+}
+
+func (h *APIKeyHandler) ListAPIKeys(c *fiber.Ctx) error {
+	apiKeys, err := h.apiKeyService.ListAPIKeys(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": apiKeys})
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(c *fiber.Ctx) error {
+	err := h.apiKeyService.RevokeAPIKey(c.UserContext(), c.Params("id"))
+	event := newAuditEvent(c, domain.AuditEventTokenRevocation, outcomeOf(err))
+	event.TargetID, event.Details = c.Params("id"), "api key"
+	h.auditService.Record(c.UserContext(), event)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "message": "api key revoked"})
+}
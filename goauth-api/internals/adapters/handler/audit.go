@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"go-chat/internals/core/domain"
+	"go-chat/internals/core/ports"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AuditHandler struct {
+	auditService ports.AuditService
+}
+
+func NewAuditHandlers(auditService ports.AuditService) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+	}
+}
+
+func (h *AuditHandler) ListEvents(c *fiber.Ctx) error {
+	filter := &domain.AuditFilter{
+		Type:     c.Query("type"),
+		ActorID:  c.Query("actor_id"),
+		TargetID: c.Query("target_id"),
+		Outcome:  c.Query("outcome"),
+		IP:       c.Query("ip"),
+		Cursor:   c.Query("cursor"),
+	}
+
+	for name, dest := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := c.Query(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return domain.ValidationError(name + " must be an RFC 3339 timestamp")
+			}
+			*dest = &parsed
+		}
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return domain.ValidationError("limit must be a positive integer")
+		}
+		filter.Limit = limit
+	}
+
+	page, err := h.auditService.ListAuditEvents(c.UserContext(), filter)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": page})
+}
+
+// newAuditEvent starts an event for the current request, with the caller as actor when one is authenticated.
+func newAuditEvent(c *fiber.Ctx, eventType, outcome string) *domain.AuditEvent {
+	event := &domain.AuditEvent{
+		Type:      eventType,
+		Outcome:   outcome,
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	}
+
+	if user, ok := c.Locals(userLocalsKey).(*domain.User); ok {
+		event.ActorID = user.ID.String()
+	} else if client, ok := c.Locals(clientLocalsKey).(*domain.OAuthClient); ok {
+		event.ActorID = client.ClientID
+	}
+
+	return event
+}
+
+// outcomeOf maps an error to the outcome recorded for it.
+func outcomeOf(err error) string {
+	if err != nil {
+		return domain.AuditOutcomeFailure
+	}
+	return domain.AuditOutcomeSuccess
+}
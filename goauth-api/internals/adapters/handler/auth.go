@@ -1,13 +1,20 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
-	"go-chat/internals/config"
 	"go-chat/internals/core/domain"
 	"go-chat/internals/core/ports"
+	"slices"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	userLocalsKey   = "user"
+	claimsLocalsKey = "claims"
+	clientLocalsKey = "client"
 )
 
 type AuthHandler struct {
@@ -21,49 +28,174 @@ func NewAuthHandlers(authService ports.AuthService) *AuthHandler {
 }
 
 func (h *AuthHandler) Middleware(c *fiber.Ctx) error {
-	config, err := config.LoadConfig()
-	if err != nil {
-		return err
+	if apiKey, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "ApiKey "); ok {
+		return h.apiKeyMiddleware(c, apiKey)
 	}
 
 	accessToken := c.Cookies("access_token")
 	if accessToken == "" {
-		return c.SendStatus(fiber.StatusUnauthorized)
+		accessToken = bearerToken(c)
+	}
+	if accessToken == "" {
+		return domain.ErrAuthenticationRequired
 	}
 
-	token, err := jwt.ParseWithClaims(accessToken, &domain.JWTCustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Verify the algorithm is expected
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	// The verification key is picked from the key ring by the token's kid header.
+	claims, err := h.authService.ParseAccessToken(c.UserContext(), accessToken)
+	if err != nil {
+		return err
+	}
+
+	userID, err := h.authService.GetUserTokenByID(c.UserContext(), claims.ID)
+	if errors.Is(err, ports.ErrCacheMiss) {
+		return domain.ErrAccessTokenInvalid
+	}
+	if err != nil {
+		return err
+	}
+
+	// Tokens from the client_credentials grant name a client rather than a user.
+	if claims.IsClient() {
+		client, err := h.authService.GetOAuthClient(c.UserContext(), userID)
+		if errors.Is(err, domain.ErrNotFound) {
+			return domain.ErrAccessTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+		if client.ClientID != claims.ClientID {
+			return domain.ErrAccessTokenInvalid
 		}
 
-		// Return the secret key for verification
-		return []byte(config.JWTAccessTokenSecret), nil
-	})
+		c.Locals(clientLocalsKey, client)
+		c.Locals(claimsLocalsKey, claims)
+
+		return c.Next()
+	}
+
+	user, err := h.authService.GetUserByID(c.UserContext(), userID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return domain.ErrAccessTokenInvalid
+	}
 	if err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"status":  "fail",
-			"message": err.Error(),
-		})
+		return err
+	}
+
+	c.Locals(userLocalsKey, user)
+	c.Locals(claimsLocalsKey, claims)
+
+	return c.Next()
+}
+
+// RequireUser rejects callers that are not a user acting for themselves, such
+// as OAuth clients, whether authenticated for themselves or for a user, and
+// service accounts. It must run after Middleware.
+func (h *AuthHandler) RequireUser(c *fiber.Ctx) error {
+	if !isPersonalLogin(c) || currentClaims(c).IsDelegated() {
+		return domain.ErrUserRequired
+	}
+
+	return c.Next()
+}
+
+// RequireUserOrDelegate is RequireUser that also lets OAuth clients acting for
+// a user through, for endpoints such as userinfo that exist to serve them.
+func (h *AuthHandler) RequireUserOrDelegate(c *fiber.Ctx) error {
+	if !isPersonalLogin(c) {
+		return domain.ErrUserRequired
 	}
 
-	claims := token.Claims.(*domain.JWTCustomClaims)
-	userID, err := h.authService.GetUserTokenByID(claims.ID)
+	return c.Next()
+}
+
+// isPersonalLogin reports whether the caller is a person logged in with an
+// access token, rather than a client or a service account with an API key.
+func isPersonalLogin(c *fiber.Ctx) bool {
+	user, ok := c.Locals(userLocalsKey).(*domain.User)
+	return ok && !user.ServiceAccount && currentClaims(c).TokenUse == domain.TokenUseAccess
+}
+
+// apiKeyMiddleware authenticates a service account by API key and stores the
+// same locals as Middleware, with claims describing the key.
+func (h *AuthHandler) apiKeyMiddleware(c *fiber.Ctx, apiKey string) error {
+	claims, err := h.authService.AuthenticateAPIKey(c.UserContext(), apiKey)
 	if err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "fail", "message": "Token is invalid or session has expired"})
+		return err
 	}
 
-	_, err = h.authService.GetUserByID(userID)
+	user, err := h.authService.GetUserByID(c.UserContext(), claims.UserID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return domain.ErrAPIKeyInvalid
+	}
 	if err != nil {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "fail", "message": "the user belonging to this token no logger exists"})
+		return err
 	}
 
-	if !token.Valid {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"status":  "fail",
-			"message": "Invalid access token",
+	c.Locals(userLocalsKey, user)
+	c.Locals(claimsLocalsKey, claims)
+
+	return c.Next()
+}
+
+// RequirePermission returns a handler that lets the request through only if the
+// current user holds every one of the permissions. It must run after Middleware.
+// Permissions are looked up on each request so role changes apply immediately.
+func (h *AuthHandler) RequirePermission(permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		granted, err := h.grantedPermissions(c)
+		if err != nil {
+			return err
+		}
+
+		for _, permission := range permissions {
+			if !slices.Contains(granted, permission) {
+				return fmt.Errorf("%w %s", domain.ErrPermissionDenied, permission)
+			}
+		}
+
+		return c.Next()
+	}
+}
+
+// grantedPermissions returns what the caller may do. API keys and OAuth clients
+// get exactly their scopes; users get the permissions of their roles, and
+// clients acting for a user only those of them within the granted scope.
+func (h *AuthHandler) grantedPermissions(c *fiber.Ctx) ([]string, error) {
+	claims := currentClaims(c)
+	if claims.TokenUse == domain.TokenUseAPIKey || claims.IsClient() {
+		return strings.Fields(claims.Scope), nil
+	}
+
+	permissions, err := h.authService.GetUserPermissions(c.UserContext(), currentUser(c).ID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.IsDelegated() {
+		scope := strings.Fields(claims.Scope)
+		permissions = slices.DeleteFunc(permissions, func(permission string) bool {
+			return !slices.Contains(scope, permission)
 		})
 	}
 
-	return c.Next()
+	return permissions, nil
+}
+
+// currentUser returns the user stored by Middleware. It must only be called from routes behind RequireUser.
+func currentUser(c *fiber.Ctx) *domain.User {
+	return c.Locals(userLocalsKey).(*domain.User)
+}
+
+// currentClaims returns the access token claims stored by Middleware.
+func currentClaims(c *fiber.Ctx) *domain.JWTCustomClaims {
+	return c.Locals(claimsLocalsKey).(*domain.JWTCustomClaims)
+}
+
+// bearerToken returns the token of an `Authorization: Bearer` header, or "" for any other scheme.
+func bearerToken(c *fiber.Ctx) string {
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return token
 }
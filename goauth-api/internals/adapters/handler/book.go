@@ -3,6 +3,7 @@ package handler
 import (
 	"go-chat/internals/core/domain"
 	"go-chat/internals/core/ports"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -18,44 +19,70 @@ func NewBookHandlers(bookService ports.BookService) *BookHandler {
 }
 
 func (h *BookHandler) GetBooks(c *fiber.Ctx) error {
-	books, err := h.bookService.GetBooks()
+	filter := &domain.BookFilter{
+		Title:  c.Query("title"),
+		Sort:   c.Query("sort"),
+		Cursor: c.Query("cursor"),
+	}
+
+	if value := c.Query("deleted"); value != "" {
+		deleted, err := strconv.ParseBool(value)
+		if err != nil {
+			return domain.ValidationError("deleted must be true or false")
+		}
+		filter.Deleted = deleted
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return domain.ValidationError("limit must be a positive integer")
+		}
+		filter.Limit = limit
+	}
+
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return domain.ValidationError("offset must be a non-negative integer")
+		}
+		filter.Offset = offset
+	}
+
+	page, err := h.bookService.GetBooks(c.UserContext(), filter)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"status":  "error",
-			"message": err.Error(),
-		})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"status": "success",
-		"data":   books,
+		"data":   page.Books,
+		"meta":   page.Meta,
 	})
 }
 
-func (h *BookHandler) CreateBook(c *fiber.Ctx) error {
-	book := domain.Book{}
-	// var req string
-	err := c.BodyParser(&book)
+func (h *BookHandler) GetBook(c *fiber.Ctx) error {
+	book, err := h.bookService.GetBook(c.UserContext(), c.Params("id"))
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"status":  "fail",
-			"message": "invalid request body",
-		})
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": book})
+}
+
+func (h *BookHandler) CreateBook(c *fiber.Ctx) error {
+	var req domain.BookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidRequestBody
 	}
 
-	if book.Title == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"status":  "fail",
-			"message": "title is required",
-		})
+	if req.Title == "" {
+		return domain.ValidationError("title is required")
 	}
 
-	result, err := h.bookService.CreateBook(book.Title)
+	result, err := h.bookService.CreateBook(c.UserContext(), req.Title)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"status":  "error",
-			"message": err.Error(),
-		})
+		return err
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -63,3 +90,54 @@ func (h *BookHandler) CreateBook(c *fiber.Ctx) error {
 		"data":   result,
 	})
 }
+
+// ReplaceBook handles PUT, which sets every field of the book.
+func (h *BookHandler) ReplaceBook(c *fiber.Ctx) error {
+	var req domain.BookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidRequestBody
+	}
+
+	if req.Title == "" {
+		return domain.ValidationError("title is required")
+	}
+
+	book, err := h.bookService.UpdateBook(c.UserContext(), c.Params("id"), &domain.BookUpdate{Title: &req.Title})
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": book})
+}
+
+// UpdateBook handles PATCH, which changes only the fields present in the body.
+func (h *BookHandler) UpdateBook(c *fiber.Ctx) error {
+	var req domain.BookUpdate
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidRequestBody
+	}
+
+	book, err := h.bookService.UpdateBook(c.UserContext(), c.Params("id"), &req)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": book})
+}
+
+func (h *BookHandler) DeleteBook(c *fiber.Ctx) error {
+	if err := h.bookService.DeleteBook(c.UserContext(), c.Params("id")); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "message": "book deleted"})
+}
+
+func (h *BookHandler) RestoreBook(c *fiber.Ctx) error {
+	book, err := h.bookService.RestoreBook(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": book})
+}
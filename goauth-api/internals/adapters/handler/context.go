@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequestContext gives each request a context that ends after timeout. Handlers
+// pass it on through c.UserContext(), so every cache and database call made for
+// the request stops at the deadline.
+func RequestContext(timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var ctx context.Context
+		var cancel context.CancelFunc
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(c.UserContext(), timeout)
+		} else {
+			ctx, cancel = context.WithCancel(c.UserContext())
+		}
+		defer cancel()
+
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"errors"
+	"go-chat/internals/core/domain"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const problemContentType = "application/problem+json"
+
+var errInvalidRequestBody = domain.NewError(domain.ErrInvalidInput, "invalid_request_body", "invalid request body")
+
+// problem is an RFC 7807 problem details object. Code is the stable
+// identifier clients branch on; Detail is meant for people.
+type problem struct {
+	Type     string                           `json:"type"`
+	Title    string                           `json:"title"`
+	Status   int                              `json:"status"`
+	Code     string                           `json:"code"`
+	Detail   string                           `json:"detail,omitempty"`
+	Instance string                           `json:"instance,omitempty"`
+	Errors   []domain.PasswordPolicyViolation `json:"errors,omitempty"`
+}
+
+// kindStatuses maps each kind of domain error to the status it is reported with.
+var kindStatuses = []struct {
+	kind   *domain.Error
+	status int
+}{
+	{domain.ErrInvalidInput, fiber.StatusBadRequest},
+	{domain.ErrUnauthorized, fiber.StatusUnauthorized},
+	{domain.ErrTokenInvalid, fiber.StatusUnauthorized},
+	{domain.ErrTokenExpired, fiber.StatusUnauthorized},
+	{domain.ErrTokenReused, fiber.StatusUnauthorized},
+	{domain.ErrForbidden, fiber.StatusForbidden},
+	{domain.ErrNotFound, fiber.StatusNotFound},
+	{domain.ErrConflict, fiber.StatusConflict},
+	{domain.ErrRateLimited, fiber.StatusTooManyRequests},
+}
+
+// ErrorHandler renders every error returned by a handler as
+// application/problem+json. Domain errors keep their code and message; any
+// other error is logged and reported as a 500 without its details.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	p := problem{Type: "about:blank", Instance: c.OriginalURL()}
+
+	var domainErr *domain.Error
+	var fiberErr *fiber.Error
+	switch {
+	case errors.As(err, &domainErr):
+		p.Status = fiber.StatusInternalServerError
+		for _, k := range kindStatuses {
+			if errors.Is(err, k.kind) {
+				p.Status = k.status
+				break
+			}
+		}
+		p.Code, p.Detail = domainErr.Code, err.Error()
+	case errors.As(err, &fiberErr):
+		// Raised by Fiber itself, such as for an unknown route or an oversized body.
+		p.Status, p.Detail = fiberErr.Code, fiberErr.Message
+		p.Code = strings.ReplaceAll(strings.ToLower(http.StatusText(fiberErr.Code)), " ", "_")
+	default:
+		log.Printf("%s %s: %v", c.Method(), c.Path(), err)
+		p.Status, p.Code = fiber.StatusInternalServerError, "internal_error"
+	}
+	p.Title = http.StatusText(p.Status)
+
+	var policyErr *domain.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		p.Errors = policyErr.Violations
+	}
+
+	// Retry-After is given in whole seconds, rounded up.
+	var rateLimitErr *domain.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		retryAfter := int64(math.Ceil(rateLimitErr.RetryAfter.Seconds()))
+		c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(max(retryAfter, 1), 10))
+	}
+
+	return c.Status(p.Status).JSON(p, problemContentType)
+}
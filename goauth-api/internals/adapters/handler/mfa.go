@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"go-chat/internals/config"
+	"go-chat/internals/core/domain"
+	"go-chat/internals/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type MFAHandler struct {
+	mfaService   ports.MFAService
+	auditService ports.AuditService
+	config       config.Config
+}
+
+func NewMFAHandlers(mfaService ports.MFAService, auditService ports.AuditService, config config.Config) *MFAHandler {
+	return &MFAHandler{
+		mfaService:   mfaService,
+		auditService: auditService,
+		config:       config,
+	}
+}
+
+func (h *MFAHandler) Enroll(c *fiber.Ctx) error {
+	user := currentUser(c)
+
+	enrollment, err := h.mfaService.EnrollTOTP(c.UserContext(), user.ID.String())
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": enrollment})
+}
+
+func (h *MFAHandler) Confirm(c *fiber.Ctx) error {
+	var req domain.MFACodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidRequestBody
+	}
+
+	user := currentUser(c)
+	recoveryCodes, err := h.mfaService.ConfirmTOTP(c.UserContext(), user.ID.String(), req.Code)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data": fiber.Map{
+			"recovery_codes": recoveryCodes,
+		},
+	})
+}
+
+func (h *MFAHandler) Disable(c *fiber.Ctx) error {
+	var req domain.MFACodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidRequestBody
+	}
+
+	user := currentUser(c)
+	if err := h.mfaService.DisableTOTP(c.UserContext(), user.ID.String(), req.Code); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "message": "two-factor authentication disabled"})
+}
+
+func (h *MFAHandler) Verify(c *fiber.Ctx) error {
+	var req domain.MFAVerifyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidRequestBody
+	}
+
+	if req.MFAToken == "" || req.Code == "" {
+		return domain.ValidationError("mfa_token and code are required")
+	}
+
+	user, err := h.mfaService.VerifyMFA(c.UserContext(), req.MFAToken, req.Code, clientInfo(c, req.DeviceName))
+	event := newAuditEvent(c, domain.AuditEventLogin, outcomeOf(err))
+	if err != nil {
+		event.Details = "two-factor code: " + err.Error()
+		h.auditService.Record(c.UserContext(), event)
+		return err
+	}
+	event.ActorID, event.TargetID, event.Details = user.ID.String(), user.ID.String(), "password and two-factor code"
+	h.auditService.Record(c.UserContext(), event)
+
+	setTokenCookies(c, user.AccessToken, user.RefreshToken, h.config.AccessTokenExpiredIn, h.config.RefreshTokenExpiredIn)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": user})
+}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"go-chat/internals/core/domain"
+	"go-chat/internals/core/ports"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type OAuthHandler struct {
+	oauthService ports.OAuthService
+	auditService ports.AuditService
+}
+
+func NewOAuthHandlers(oauthService ports.OAuthService, auditService ports.AuditService) *OAuthHandler {
+	return &OAuthHandler{
+		oauthService: oauthService,
+		auditService: auditService,
+	}
+}
+
+func (h *OAuthHandler) CreateClient(c *fiber.Ctx) error {
+	var req domain.CreateOAuthClientRequest
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidRequestBody
+	}
+
+	user := currentUser(c)
+	client, secret, err := h.oauthService.CreateOAuthClient(c.UserContext(), user.ID.String(), &req)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status": "success",
+		"data":   domain.CreateOAuthClientResponse{OAuthClient: client, ClientSecret: secret},
+	})
+}
+
+// Authorize starts the authorization code flow. When the user must first agree
+// to what the client asks for, it answers with a consent prompt instead of a
+// redirect, and the user's answer comes back through AnswerConsent.
+func (h *OAuthHandler) Authorize(c *fiber.Ctx) error {
+	var req domain.AuthorizationRequest
+	if err := c.QueryParser(&req); err != nil {
+		return sendOAuthError(c, &domain.OAuthError{Code: "invalid_request", Status: fiber.StatusBadRequest})
+	}
+	// A link must never be able to answer the prompt on the user's behalf.
+	req.Consent = ""
+
+	return h.authorize(c, &req)
+}
+
+// AnswerConsent takes the user's answer to a consent prompt together with the
+// parameters of the authorization request. Being a POST, it is not sent with
+// the SameSite=Lax session cookie from other sites, so they cannot forge it.
+func (h *OAuthHandler) AnswerConsent(c *fiber.Ctx) error {
+	var req domain.AuthorizationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return sendOAuthError(c, &domain.OAuthError{Code: "invalid_request", Status: fiber.StatusBadRequest})
+	}
+	if req.Consent == "" {
+		return sendOAuthError(c, &domain.OAuthError{Code: "invalid_request", Description: "consent is required", Status: fiber.StatusBadRequest})
+	}
+
+	return h.authorize(c, &req)
+}
+
+func (h *OAuthHandler) authorize(c *fiber.Ctx, req *domain.AuthorizationRequest) error {
+	user := currentUser(c)
+	result, err := h.oauthService.Authorize(c.UserContext(), user.ID.String(), currentClaims(c).FamilyID, req)
+	if err != nil {
+		return sendOAuthError(c, err)
+	}
+
+	if result.Consent != nil {
+		c.Set(fiber.HeaderCacheControl, "no-store")
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":  "success",
+			"message": "consent required: POST the same parameters to this endpoint with consent set to approve or deny",
+			"data":    result.Consent,
+		})
+	}
+
+	return c.Redirect(result.RedirectURL, fiber.StatusFound)
+}
+
+func (h *OAuthHandler) Token(c *fiber.Ctx) error {
+	var req domain.TokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return sendOAuthError(c, &domain.OAuthError{Code: "invalid_request", Status: fiber.StatusBadRequest})
+	}
+
+	// Client credentials may also be sent with HTTP Basic authentication (RFC 6749 section 2.3.1).
+	if clientID, clientSecret, ok := basicAuth(c); ok {
+		req.ClientID, req.ClientSecret = clientID, clientSecret
+	}
+
+	tokens, err := h.oauthService.ExchangeToken(c.UserContext(), &req, clientInfo(c, ""))
+	if err != nil {
+		return sendOAuthError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusOK).JSON(tokens)
+}
+
+func (h *OAuthHandler) Introspect(c *fiber.Ctx) error {
+	var req domain.IntrospectionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return sendOAuthError(c, &domain.OAuthError{Code: "invalid_request", Status: fiber.StatusBadRequest})
+	}
+
+	if clientID, clientSecret, ok := basicAuth(c); ok {
+		req.ClientID, req.ClientSecret = clientID, clientSecret
+	}
+
+	introspection, err := h.oauthService.IntrospectToken(c.UserContext(), &req)
+	if err != nil {
+		return sendOAuthError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusOK).JSON(introspection)
+}
+
+func (h *OAuthHandler) Revoke(c *fiber.Ctx) error {
+	var req domain.RevocationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return sendOAuthError(c, &domain.OAuthError{Code: "invalid_request", Status: fiber.StatusBadRequest})
+	}
+
+	if clientID, clientSecret, ok := basicAuth(c); ok {
+		req.ClientID, req.ClientSecret = clientID, clientSecret
+	}
+
+	err := h.oauthService.RevokeToken(c.UserContext(), &req)
+	event := newAuditEvent(c, domain.AuditEventTokenRevocation, outcomeOf(err))
+	event.ActorID, event.Details = req.ClientID, "oauth revocation endpoint"
+	if err != nil {
+		event.Details += ": " + err.Error()
+	}
+	h.auditService.Record(c.UserContext(), event)
+	if err != nil {
+		return sendOAuthError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func sendOAuthError(c *fiber.Ctx, err error) error {
+	var oauthErr *domain.OAuthError
+	if !errors.As(err, &oauthErr) {
+		log.Printf("%s %s: %v", c.Method(), c.Path(), err)
+		oauthErr = &domain.OAuthError{Code: "server_error", Status: fiber.StatusInternalServerError}
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(oauthErr.Status).JSON(oauthErr)
+}
+
+func basicAuth(c *fiber.Ctx) (string, string, bool) {
+	encoded, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Basic ")
+	if !ok {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", false
+	}
+
+	// Both parts are form-urlencoded before being joined.
+	clientID, err := url.QueryUnescape(username)
+	if err != nil {
+		return "", "", false
+	}
+	clientSecret, err := url.QueryUnescape(password)
+	if err != nil {
+		return "", "", false
+	}
+
+	return clientID, clientSecret, true
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"go-chat/internals/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type OIDCHandler struct {
+	oidcService ports.OIDCService
+}
+
+func NewOIDCHandlers(oidcService ports.OIDCService) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: oidcService,
+	}
+}
+
+func (h *OIDCHandler) Discovery(c *fiber.Ctx) error {
+	configuration, err := h.oidcService.OpenIDConfiguration(c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(configuration)
+}
+
+func (h *OIDCHandler) JWKS(c *fiber.Ctx) error {
+	keySet, err := h.oidcService.JWKS(c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(keySet)
+}
+
+// UserInfo answers clients with the claims their token's scope grants. Users
+// asking about themselves get every claim.
+func (h *OIDCHandler) UserInfo(c *fiber.Ctx) error {
+	user := currentUser(c)
+
+	scope := "email profile"
+	if claims := currentClaims(c); claims.IsDelegated() {
+		scope = claims.Scope
+	}
+
+	userInfo, err := h.oidcService.UserInfo(c.UserContext(), user.ID.String(), scope)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(userInfo)
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"go-chat/internals/config"
+	"go-chat/internals/core/domain"
+	"go-chat/internals/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PasskeyHandler struct {
+	passkeyService ports.PasskeyService
+	auditService   ports.AuditService
+	config         config.Config
+}
+
+func NewPasskeyHandlers(passkeyService ports.PasskeyService, auditService ports.AuditService, config config.Config) *PasskeyHandler {
+	return &PasskeyHandler{
+		passkeyService: passkeyService,
+		auditService:   auditService,
+		config:         config,
+	}
+}
+
+func (h *PasskeyHandler) BeginRegistration(c *fiber.Ctx) error {
+	user := currentUser(c)
+
+	options, err := h.passkeyService.BeginPasskeyRegistration(c.UserContext(), user.ID.String())
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": fiber.Map{"publicKey": options}})
+}
+
+func (h *PasskeyHandler) FinishRegistration(c *fiber.Ctx) error {
+	var req domain.PasskeyRegistrationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidRequestBody
+	}
+
+	user := currentUser(c)
+	credential, err := h.passkeyService.FinishPasskeyRegistration(c.UserContext(), user.ID.String(), req.Name, &req.Credential)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": credential})
+}
+
+func (h *PasskeyHandler) BeginLogin(c *fiber.Ctx) error {
+	options, err := h.passkeyService.BeginPasskeyLogin(c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": fiber.Map{"publicKey": options}})
+}
+
+func (h *PasskeyHandler) FinishLogin(c *fiber.Ctx) error {
+	var req domain.AssertionCredential
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidRequestBody
+	}
+
+	user, err := h.passkeyService.FinishPasskeyLogin(c.UserContext(), &req, clientInfo(c, ""))
+	event := newAuditEvent(c, domain.AuditEventLogin, outcomeOf(err))
+	if err != nil {
+		event.Details = "passkey: " + err.Error()
+		h.auditService.Record(c.UserContext(), event)
+		return err
+	}
+	event.ActorID, event.TargetID, event.Details = user.ID.String(), user.ID.String(), "passkey"
+	h.auditService.Record(c.UserContext(), event)
+
+	setTokenCookies(c, user.AccessToken, user.RefreshToken, h.config.AccessTokenExpiredIn, h.config.RefreshTokenExpiredIn)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": user})
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"go-chat/internals/core/domain"
+	"go-chat/internals/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type RoleHandler struct {
+	roleService  ports.RoleService
+	auditService ports.AuditService
+}
+
+func NewRoleHandlers(roleService ports.RoleService, auditService ports.AuditService) *RoleHandler {
+	return &RoleHandler{
+		roleService:  roleService,
+		auditService: auditService,
+	}
+}
+
+func (h *RoleHandler) ListRoles(c *fiber.Ctx) error {
+	roles, err := h.roleService.ListRoles(c.UserContext())
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": roles})
+}
+
+func (h *RoleHandler) GetUserRoles(c *fiber.Ctx) error {
+	roles, err := h.roleService.GetUserRoles(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": roles})
+}
+
+func (h *RoleHandler) AssignRole(c *fiber.Ctx) error {
+	var req domain.AssignRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidRequestBody
+	}
+
+	if req.Role == "" {
+		return domain.ValidationError("role is required")
+	}
+
+	err := h.roleService.AssignRole(c.UserContext(), c.Params("id"), req.Role)
+	event := newAuditEvent(c, domain.AuditEventRoleChange, outcomeOf(err))
+	event.TargetID, event.Details = c.Params("id"), "assign "+req.Role
+	h.auditService.Record(c.UserContext(), event)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "message": "role assigned"})
+}
+
+func (h *RoleHandler) RemoveRole(c *fiber.Ctx) error {
+	err := h.roleService.RemoveRole(c.UserContext(), c.Params("id"), c.Params("role"))
+	event := newAuditEvent(c, domain.AuditEventRoleChange, outcomeOf(err))
+	event.TargetID, event.Details = c.Params("id"), "remove "+c.Params("role")
+	h.auditService.Record(c.UserContext(), event)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "message": "role removed"})
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"go-chat/internals/core/domain"
+	"go-chat/internals/core/ports"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type SessionHandler struct {
+	sessionService ports.SessionService
+	auditService   ports.AuditService
+}
+
+func NewSessionHandlers(sessionService ports.SessionService, auditService ports.AuditService) *SessionHandler {
+	return &SessionHandler{
+		sessionService: sessionService,
+		auditService:   auditService,
+	}
+}
+
+func (h *SessionHandler) ListSessions(c *fiber.Ctx) error {
+	user := currentUser(c)
+
+	sessions, err := h.sessionService.ListSessions(c.UserContext(), user.ID.String(), currentClaims(c).FamilyID)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": sessions})
+}
+
+func (h *SessionHandler) RevokeSession(c *fiber.Ctx) error {
+	user := currentUser(c)
+
+	err := h.sessionService.RevokeSession(c.UserContext(), user.ID.String(), c.Params("id"))
+	event := newAuditEvent(c, domain.AuditEventTokenRevocation, outcomeOf(err))
+	event.TargetID, event.Details = user.ID.String(), "session "+c.Params("id")
+	h.auditService.Record(c.UserContext(), event)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "message": "session revoked"})
+}
+
+func (h *SessionHandler) RevokeOtherSessions(c *fiber.Ctx) error {
+	user := currentUser(c)
+
+	err := h.sessionService.RevokeOtherSessions(c.UserContext(), user.ID.String(), currentClaims(c).FamilyID)
+	event := newAuditEvent(c, domain.AuditEventTokenRevocation, outcomeOf(err))
+	event.TargetID, event.Details = user.ID.String(), "all other sessions"
+	h.auditService.Record(c.UserContext(), event)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "message": "all other sessions revoked"})
+}
+
+// clientInfo describes the requesting device. The label falls back to one derived from the user agent.
+func clientInfo(c *fiber.Ctx, deviceName string) domain.ClientInfo {
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if deviceName == "" {
+		deviceName = deviceLabel(userAgent)
+	}
+
+	return domain.ClientInfo{
+		IP:          c.IP(),
+		UserAgent:   userAgent,
+		DeviceLabel: deviceName,
+	}
+}
+
+func deviceLabel(userAgent string) string {
+	browsers := []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	}
+	systems := []struct{ token, name string }{
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+
+	browser, system := "", ""
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, s := range systems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	case userAgent != "":
+		return userAgent
+	default:
+		return "Unknown device"
+	}
+}
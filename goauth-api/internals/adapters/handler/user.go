@@ -10,46 +10,82 @@ import (
 )
 
 type UserHandler struct {
-	userService ports.UserService
+	userService  ports.UserService
+	auditService ports.AuditService
+	config       config.Config
 }
 
-func NewUserHandlers(userService ports.UserService) *UserHandler {
+func NewUserHandlers(userService ports.UserService, auditService ports.AuditService, config config.Config) *UserHandler {
 	return &UserHandler{
-		userService: userService,
+		userService:  userService,
+		auditService: auditService,
+		config:       config,
 	}
 }
 
 func (h *UserHandler) Register(c *fiber.Ctx) error {
 	var req domain.RegisterRequest
 	if err := c.BodyParser(&req); err != nil {
-		return sendErrorResponse(c, fiber.StatusBadRequest, "invalid request body")
+		return errInvalidRequestBody
 	}
 
-	user, err := h.userService.CreateUser(req.Email, req.Username, req.Password)
+	if h.config.EnumerationSafeRegistration {
+		return h.registerPrivately(c, &req)
+	}
+
+	user, err := h.userService.CreateUser(c.UserContext(), req.Email, req.Username, req.Password)
+	event := newAuditEvent(c, domain.AuditEventRegister, outcomeOf(err))
 	if err != nil {
-		return sendErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		event.TargetID, event.Details = req.Email, err.Error()
+		h.auditService.Record(c.UserContext(), event)
+		return err
 	}
+	event.ActorID, event.TargetID = user.ID.String(), user.ID.String()
+	h.auditService.Record(c.UserContext(), event)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": user})
 }
 
-func (h *UserHandler) LoginUser(c *fiber.Ctx) error {
-	config, err := config.LoadConfig()
+// registerPrivately answers 202 whether or not the account was created, so the
+// response does not reveal which emails and usernames are registered.
+func (h *UserHandler) registerPrivately(c *fiber.Ctx, req *domain.RegisterRequest) error {
+	err := h.userService.RegisterPrivately(c.UserContext(), req.Email, req.Username, req.Password)
+	event := newAuditEvent(c, domain.AuditEventRegister, outcomeOf(err))
+	event.TargetID = req.Email
 	if err != nil {
+		event.Details = err.Error()
+		h.auditService.Record(c.UserContext(), event)
 		return err
 	}
+	h.auditService.Record(c.UserContext(), event)
 
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"status": "success", "message": "check your email to finish registering"})
+}
+
+func (h *UserHandler) LoginUser(c *fiber.Ctx) error {
 	var req domain.LoginRequest
 	if err := c.BodyParser(&req); err != nil {
-		return sendErrorResponse(c, fiber.StatusBadRequest, "invalid request body")
+		return errInvalidRequestBody
 	}
 
-	user, err := h.userService.LoginUser(req.Email, req.Password)
+	user, err := h.userService.LoginUser(c.UserContext(), req.Email, req.Password, clientInfo(c, req.DeviceName))
 	if err != nil {
-		return sendErrorResponse(c, fiber.StatusUnauthorized, err.Error())
+		event := newAuditEvent(c, domain.AuditEventLogin, domain.AuditOutcomeFailure)
+		event.TargetID, event.Details = req.Email, err.Error()
+		h.auditService.Record(c.UserContext(), event)
+		return err
 	}
 
-	setTokenCookies(c, user.AccessToken, user.RefreshToken, config.AccessTokenExpiredIn, config.RefreshTokenExpiredIn)
+	// With MFA enabled the login is audited once the second factor is verified.
+	if user.MFARequired {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": user})
+	}
+
+	event := newAuditEvent(c, domain.AuditEventLogin, domain.AuditOutcomeSuccess)
+	event.ActorID, event.TargetID, event.Details = user.ID.String(), user.ID.String(), "password"
+	h.auditService.Record(c.UserContext(), event)
+
+	setTokenCookies(c, user.AccessToken, user.RefreshToken, h.config.AccessTokenExpiredIn, h.config.RefreshTokenExpiredIn)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": user})
 }
@@ -57,12 +93,18 @@ func (h *UserHandler) LoginUser(c *fiber.Ctx) error {
 func (h *UserHandler) LogoutUser(c *fiber.Ctx) error {
 	refreshToken := c.Cookies("refresh_token")
 	if refreshToken == "" {
-		return sendErrorResponse(c, fiber.StatusBadRequest, "refresh token not found")
+		return domain.ErrRefreshTokenMissing
 	}
 
-	if err := h.userService.LogoutUser(refreshToken); err != nil {
-		return sendErrorResponse(c, fiber.StatusInternalServerError, err.Error())
+	userID, err := h.userService.LogoutUser(c.UserContext(), refreshToken)
+	event := newAuditEvent(c, domain.AuditEventLogout, outcomeOf(err))
+	event.ActorID, event.TargetID = userID, userID
+	if err != nil {
+		event.Details = err.Error()
+		h.auditService.Record(c.UserContext(), event)
+		return err
 	}
+	h.auditService.Record(c.UserContext(), event)
 
 	cookieNames := []string{"refresh_token", "access_token"}
 	clearTokenCookies(cookieNames, c)
@@ -71,22 +113,22 @@ func (h *UserHandler) LogoutUser(c *fiber.Ctx) error {
 }
 
 func (h *UserHandler) RefreshTokens(c *fiber.Ctx) error {
-	config, err := config.LoadConfig()
-	if err != nil {
-		return err
-	}
-
 	refreshToken := c.Cookies("refresh_token")
 	if refreshToken == "" {
-		return sendErrorResponse(c, fiber.StatusBadRequest, "refresh token not provided")
+		return domain.ErrRefreshTokenMissing
 	}
 
-	result, err := h.userService.RefreshTokens(refreshToken)
+	result, err := h.userService.RefreshTokens(c.UserContext(), refreshToken, clientInfo(c, ""))
+	event := newAuditEvent(c, domain.AuditEventRefresh, outcomeOf(err))
 	if err != nil {
-		return sendErrorResponse(c, fiber.StatusInternalServerError, err.Error())
+		event.Details = err.Error()
+		h.auditService.Record(c.UserContext(), event)
+		return err
 	}
+	event.ActorID, event.TargetID = result.ID.String(), result.ID.String()
+	h.auditService.Record(c.UserContext(), event)
 
-	setTokenCookies(c, result.AccessToken, result.RefreshToken, config.AccessTokenExpiredIn, config.RefreshTokenExpiredIn)
+	setTokenCookies(c, result.AccessToken, result.RefreshToken, h.config.AccessTokenExpiredIn, h.config.RefreshTokenExpiredIn)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"status": "success",
@@ -98,11 +140,86 @@ func (h *UserHandler) RefreshTokens(c *fiber.Ctx) error {
 	})
 }
 
-func sendErrorResponse(c *fiber.Ctx, status int, message string) error {
-	return c.Status(status).JSON(fiber.Map{
-		"status":  "fail",
-		"message": message,
-	})
+func (h *UserHandler) VerifyEmail(c *fiber.Ctx) error {
+	var req domain.VerifyEmailRequest
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidRequestBody
+	}
+
+	if req.Token == "" {
+		return domain.ValidationError("token is required")
+	}
+
+	if err := h.userService.VerifyEmail(c.UserContext(), req.Token); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "message": "email verified successfully"})
+}
+
+func (h *UserHandler) ResendVerification(c *fiber.Ctx) error {
+	var req domain.ResendVerificationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidRequestBody
+	}
+
+	if req.Email == "" {
+		return domain.ValidationError("email is required")
+	}
+
+	h.userService.ResendVerification(c.UserContext(), req.Email)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "message": "if the account exists and is unverified, a verification email has been sent"})
+}
+
+func (h *UserHandler) ForgotPassword(c *fiber.Ctx) error {
+	var req domain.ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidRequestBody
+	}
+
+	if req.Email == "" {
+		return domain.ValidationError("email is required")
+	}
+
+	h.userService.ForgotPassword(c.UserContext(), req.Email)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "message": "if the account exists, a password reset email has been sent"})
+}
+
+func (h *UserHandler) ResetPassword(c *fiber.Ctx) error {
+	var req domain.ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return errInvalidRequestBody
+	}
+
+	if req.Token == "" || req.Password == "" {
+		return domain.ValidationError("token and password are required")
+	}
+
+	user, err := h.userService.ResetPassword(c.UserContext(), req.Token, req.Password)
+	event := newAuditEvent(c, domain.AuditEventPasswordChange, outcomeOf(err))
+	if err != nil {
+		event.Details = err.Error()
+		h.auditService.Record(c.UserContext(), event)
+		return err
+	}
+	event.ActorID, event.TargetID, event.Details = user.ID.String(), user.ID.String(), "password reset"
+	h.auditService.Record(c.UserContext(), event)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "message": "password reset successfully"})
+}
+
+func (h *UserHandler) UnlockAccount(c *fiber.Ctx) error {
+	err := h.userService.UnlockAccount(c.UserContext(), c.Params("id"))
+	event := newAuditEvent(c, domain.AuditEventAccountUnlock, outcomeOf(err))
+	event.TargetID = c.Params("id")
+	h.auditService.Record(c.UserContext(), event)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "message": "account unlocked"})
 }
 
 func setTokenCookies(c *fiber.Ctx, accessToken, refreshToken string, accessTokenExp, refreshTokenExp time.Duration) {
@@ -0,0 +1,117 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxBreachedLineLength bounds a line: the hash, a colon, a count and a line ending.
+const maxBreachedLineLength = 128
+
+// BreachedList looks up SHA-1 hashes of leaked passwords in a file sorted by
+// hash, such as the ordered-by-hash download of Have I Been Pwned. The file
+// is binary searched on each lookup rather than read into memory, so lists
+// with hundreds of millions of hashes take no more than an open file.
+type BreachedList struct {
+	file *os.File
+	size int64
+}
+
+// LoadBreachedList opens a file with one uppercase or lowercase hex SHA-1 hash
+// per line, optionally followed by ":<count>", sorted by hash. Only the first
+// line is checked here; a file out of order makes lookups miss hashes.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %v", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open breached password list: %v", err)
+	}
+
+	list := &BreachedList{file: file, size: info.Size()}
+	if list.size > 0 {
+		_, hash, err := list.lineAfter(0)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to read breached password list: %v", err)
+		}
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha1.Size*2 {
+			file.Close()
+			return nil, errors.New("breached password list line 1: not a SHA-1 hash")
+		}
+	}
+
+	return list, nil
+}
+
+// Contains reports whether the password's hash is on the list. Lines differ in
+// length, so the search narrows a byte range and compares the first line that
+// starts inside it.
+func (l *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	target := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	// Only lines starting in [low, high) can still hold the hash.
+	low, high := int64(0), l.size
+	for low < high {
+		middle := low + (high-low)/2
+		start, hash, err := l.lineAfter(middle)
+		if err != nil {
+			return false, fmt.Errorf("failed to read breached password list: %v", err)
+		}
+		if start >= high {
+			high = middle
+			continue
+		}
+
+		switch strings.Compare(hash, target) {
+		case 0:
+			return true, nil
+		case -1:
+			low = start + 1
+		default:
+			high = middle
+		}
+	}
+
+	return false, nil
+}
+
+// lineAfter returns the offset of the first line starting at or after offset,
+// and the upper-cased hash on it. At the end of the file the offset is l.size.
+func (l *BreachedList) lineAfter(offset int64) (int64, string, error) {
+	start := offset
+	if offset > 0 {
+		// Back up one byte so a line starting exactly at offset is found.
+		start = offset - 1
+	}
+	reader := bufio.NewReaderSize(io.NewSectionReader(l.file, start, l.size-start), maxBreachedLineLength)
+
+	if offset > 0 {
+		skipped, err := reader.ReadSlice('\n')
+		start += int64(len(skipped))
+		if errors.Is(err, io.EOF) {
+			return l.size, "", nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+	}
+
+	line, err := reader.ReadSlice('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, "", err
+	}
+	hash, _, _ := strings.Cut(string(line), ":")
+	return start, strings.ToUpper(strings.TrimSpace(hash)), nil
+}
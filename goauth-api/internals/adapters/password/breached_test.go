@@ -0,0 +1,99 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeBreachedList writes the hashes of the passwords, sorted, in the format
+// of the Have I Been Pwned download, with counts of varying length and CRLF endings.
+func writeBreachedList(t *testing.T, passwords []string) string {
+	t.Helper()
+
+	hashes := make([]string, 0, len(passwords))
+	for _, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		hashes = append(hashes, strings.ToUpper(hex.EncodeToString(sum[:])))
+	}
+	sort.Strings(hashes)
+
+	var contents strings.Builder
+	for i, hash := range hashes {
+		fmt.Fprintf(&contents, "%s:%d\r\n", hash, i*i*37+1)
+	}
+
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(contents.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBreachedListContains(t *testing.T) {
+	var breached []string
+	for i := 0; i < 1000; i++ {
+		breached = append(breached, fmt.Sprintf("password%d", i))
+	}
+	list, err := LoadBreachedList(writeBreachedList(t, breached))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every entry is found, including the first and last lines of the file.
+	for _, password := range breached {
+		found, err := list.Contains(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found {
+			t.Fatalf("%q is on the list but was not found", password)
+		}
+	}
+
+	for i := 1000; i < 2000; i++ {
+		password := fmt.Sprintf("password%d", i)
+		found, err := list.Contains(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found {
+			t.Fatalf("%q is not on the list but was found", password)
+		}
+	}
+}
+
+func TestBreachedListSingleLine(t *testing.T) {
+	sum := sha1.Sum([]byte("hunter2"))
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	// Lowercase and without a trailing newline, as a hand-written list might be.
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(sum[:])), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := LoadBreachedList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for password, want := range map[string]bool{"hunter2": true, "hunter3": false} {
+		if found, err := list.Contains(password); err != nil || found != want {
+			t.Fatalf("Contains(%q) = %v, %v, want %v", password, found, err, want)
+		}
+	}
+}
+
+func TestLoadBreachedListRejectsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte("password1\npassword2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadBreachedList(path); err == nil {
+		t.Fatal("loaded a list of plain passwords")
+	}
+}
@@ -0,0 +1,98 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+// BcryptMaxBytes is the longest password bcrypt can hash; it cannot tell apart passwords that share these bytes.
+const BcryptMaxBytes = 72
+
+// Hasher creates hashes with the configured algorithm and verifies hashes made
+// with any supported one, so stored hashes can be upgraded as users log in.
+type Hasher struct {
+	algorithm  string
+	argon2id   Argon2idParams
+	bcryptCost int
+}
+
+func NewHasher(algorithm string, argon2id Argon2idParams, bcryptCost int) (*Hasher, error) {
+	if algorithm != AlgorithmArgon2id && algorithm != AlgorithmBcrypt {
+		return nil, fmt.Errorf("unsupported password hash algorithm %q", algorithm)
+	}
+	if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if argon2id.Memory == 0 || argon2id.Time == 0 || argon2id.Parallelism == 0 {
+		return nil, errors.New("argon2id memory, time and parallelism must be positive")
+	}
+	if argon2id.SaltLength == 0 {
+		argon2id.SaltLength = 16
+	}
+	if argon2id.KeyLength == 0 {
+		argon2id.KeyLength = 32
+	}
+
+	return &Hasher{algorithm: algorithm, argon2id: argon2id, bcryptCost: bcryptCost}, nil
+}
+
+// MaxPasswordBytes returns the longest password, in bytes, the configured
+// algorithm can hash, or 0 if there is no limit.
+func (h *Hasher) MaxPasswordBytes() int {
+	if h.algorithm == AlgorithmBcrypt {
+		return BcryptMaxBytes
+	}
+	return 0
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.algorithm == AlgorithmBcrypt {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("password not hashed: %v", err)
+		}
+		return string(hashed), nil
+	}
+
+	hashed, err := hashArgon2id(password, h.argon2id)
+	if err != nil {
+		return "", fmt.Errorf("password not hashed: %v", err)
+	}
+	return hashed, nil
+}
+
+func (h *Hasher) Verify(hash, password string) (bool, bool, error) {
+	switch {
+	case strings.HasPrefix(hash, argon2idPrefix):
+		ok, params, err := verifyArgon2id(hash, password)
+		if err != nil || !ok {
+			return false, false, err
+		}
+		return true, h.algorithm != AlgorithmArgon2id || params != h.argon2id, nil
+
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		// bcrypt's modular crypt format predates PHC strings but is close enough to keep verifying.
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, false, nil
+			}
+			return false, false, err
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return false, false, err
+		}
+		return true, h.algorithm != AlgorithmBcrypt || cost != h.bcryptCost, nil
+
+	default:
+		return false, false, errors.New("unrecognized password hash format")
+	}
+}
@@ -0,0 +1,119 @@
+package password
+
+import (
+	"fmt"
+	"go-chat/internals/core/domain"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// minIdentityLength keeps very short usernames from ruling out most passwords.
+const minIdentityLength = 3
+
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// MaxBytes caps the encoded length for hashers that cannot take more, see Hasher.MaxPasswordBytes.
+	MaxBytes int
+	// MinCharacterClasses is how many of lowercase, uppercase, digits and
+	// other characters the password must mix.
+	MinCharacterClasses int
+	// Breached rejects known leaked passwords when set.
+	Breached *BreachedList
+}
+
+func (p *Policy) Check(password string, identities ...string) error {
+	var violations []domain.PasswordPolicyViolation
+	length := utf8.RuneCountInString(password)
+
+	if length < p.MinLength {
+		violations = append(violations, domain.PasswordPolicyViolation{
+			Rule:    domain.PasswordRuleMinLength,
+			Message: fmt.Sprintf("must be at least %d characters long", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, domain.PasswordPolicyViolation{
+			Rule:    domain.PasswordRuleMaxLength,
+			Message: fmt.Sprintf("must be at most %d characters long", p.MaxLength),
+		})
+	} else if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		violations = append(violations, domain.PasswordPolicyViolation{
+			Rule:    domain.PasswordRuleMaxLength,
+			Message: fmt.Sprintf("must be at most %d bytes long", p.MaxBytes),
+		})
+	}
+	if classes := characterClasses(password); classes < p.MinCharacterClasses {
+		violations = append(violations, domain.PasswordPolicyViolation{
+			Rule:    domain.PasswordRuleCharacterClasses,
+			Message: fmt.Sprintf("must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinCharacterClasses),
+		})
+	}
+	if containsIdentity(password, identities) {
+		violations = append(violations, domain.PasswordPolicyViolation{
+			Rule:    domain.PasswordRuleContainsIdentity,
+			Message: "must not contain your username or email",
+		})
+	}
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			violations = append(violations, domain.PasswordPolicyViolation{
+				Rule:    domain.PasswordRuleBreached,
+				Message: "has appeared in a data breach and must not be used",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &domain.PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	count := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+// containsIdentity checks each identity, and for emails also the part before the @.
+func containsIdentity(password string, identities []string) bool {
+	lowered := strings.ToLower(password)
+	for _, identity := range identities {
+		identity = strings.ToLower(strings.TrimSpace(identity))
+		candidates := []string{identity}
+		if local, _, ok := strings.Cut(identity, "@"); ok {
+			candidates = append(candidates, local)
+		}
+
+		for _, candidate := range candidates {
+			if utf8.RuneCountInString(candidate) >= minIdentityLength && strings.Contains(lowered, candidate) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"go-chat/internals/core/domain"
+	"go-chat/internals/core/ports"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	accountFailuresPrefix = "login_failures_account:"
+	ipFailuresPrefix      = "login_failures_ip:"
+	lockoutPrefix         = "login_lockout:"
+)
+
+type Policy struct {
+	// Window is how far back failures are counted.
+	Window time.Duration
+	// BackoffAfter failures on an account, each further attempt must wait
+	// BackoffBase, doubling per failure up to BackoffMax.
+	BackoffAfter int
+	BackoffBase  time.Duration
+	BackoffMax   time.Duration
+	// LockoutThreshold failures within the window lock the account for LockoutDuration.
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// IPLimit failures from one address within the window block it until the oldest falls out.
+	IPLimit int
+}
+
+// LoginLimiter counts failed logins per account and per client IP in sliding
+// windows. Each window is a cache set of timestamped members, so any
+// ports.CacheRepository can back it.
+type LoginLimiter struct {
+	cache  ports.CacheRepository
+	policy Policy
+	now    func() time.Time
+}
+
+func NewLoginLimiter(cache ports.CacheRepository, policy Policy) *LoginLimiter {
+	return &LoginLimiter{
+		cache:  cache,
+		policy: policy,
+		now:    time.Now,
+	}
+}
+
+func (l *LoginLimiter) Check(ctx context.Context, account, ip string) error {
+	now := l.now()
+	account = normalizeAccount(account)
+
+	var lockedUntil time.Time
+	if err := l.cache.Get(ctx, lockoutPrefix+account, &lockedUntil); err == nil && now.Before(lockedUntil) {
+		return &domain.RateLimitError{RetryAfter: lockedUntil.Sub(now), Locked: true}
+	}
+
+	accountFailures, err := l.failures(ctx, accountFailuresPrefix+account)
+	if err != nil {
+		return err
+	}
+	if delay := l.backoff(len(accountFailures)); delay > 0 {
+		if next := accountFailures[len(accountFailures)-1].Add(delay); now.Before(next) {
+			return &domain.RateLimitError{RetryAfter: next.Sub(now)}
+		}
+	}
+
+	if ip == "" || l.policy.IPLimit <= 0 {
+		return nil
+	}
+
+	ipFailures, err := l.failures(ctx, ipFailuresPrefix+ip)
+	if err != nil {
+		return err
+	}
+	if len(ipFailures) >= l.policy.IPLimit {
+		// Wait until enough failures have left the window to fall under the limit.
+		oldest := ipFailures[len(ipFailures)-l.policy.IPLimit]
+		return &domain.RateLimitError{RetryAfter: oldest.Add(l.policy.Window).Sub(now)}
+	}
+
+	return nil
+}
+
+func (l *LoginLimiter) RecordFailure(ctx context.Context, account, ip string) (time.Time, bool, error) {
+	account = normalizeAccount(account)
+
+	if ip != "" {
+		if err := l.addFailure(ctx, ipFailuresPrefix+ip); err != nil {
+			return time.Time{}, false, err
+		}
+	}
+
+	key := accountFailuresPrefix + account
+	if err := l.addFailure(ctx, key); err != nil {
+		return time.Time{}, false, err
+	}
+
+	failures, err := l.failures(ctx, key)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if l.policy.LockoutThreshold <= 0 || len(failures) < l.policy.LockoutThreshold {
+		return time.Time{}, false, nil
+	}
+
+	// The lock replaces the backoff, so start counting afresh once it ends.
+	lockedUntil := l.now().Add(l.policy.LockoutDuration)
+	if err := l.cache.Set(ctx, lockoutPrefix+account, lockedUntil, l.policy.LockoutDuration); err != nil {
+		return time.Time{}, false, err
+	}
+	if err := l.cache.Delete(ctx, key); err != nil {
+		return time.Time{}, false, err
+	}
+
+	return lockedUntil, true, nil
+}
+
+// Reset forgets the failures of an account after a successful login. Failures
+// from the IP are kept, so one valid account cannot be used to clear them.
+func (l *LoginLimiter) Reset(ctx context.Context, account string) error {
+	return l.cache.Delete(ctx, accountFailuresPrefix+normalizeAccount(account))
+}
+
+func (l *LoginLimiter) Unlock(ctx context.Context, account string) error {
+	account = normalizeAccount(account)
+	if err := l.cache.Delete(ctx, lockoutPrefix+account); err != nil {
+		return err
+	}
+	return l.cache.Delete(ctx, accountFailuresPrefix+account)
+}
+
+// failures returns the failure times still inside the window, oldest first,
+// and drops the ones that have left it.
+func (l *LoginLimiter) failures(ctx context.Context, key string) ([]time.Time, error) {
+	members, err := l.cache.GetSetMembers(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := l.now().Add(-l.policy.Window)
+	times := make([]time.Time, 0, len(members))
+	for _, member := range members {
+		nanos, _, _ := strings.Cut(member, "-")
+		unixNano, err := strconv.ParseInt(nanos, 10, 64)
+		at := time.Unix(0, unixNano)
+		// A failure exactly Window old has left it, which is when Check says to retry.
+		if err != nil || !at.After(cutoff) {
+			if err := l.cache.RemoveFromSet(ctx, key, member); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		times = append(times, at)
+	}
+
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times, nil
+}
+
+func (l *LoginLimiter) addFailure(ctx context.Context, key string) error {
+	// The random suffix keeps simultaneous failures from collapsing into one member.
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+
+	member := fmt.Sprintf("%d-%s", l.now().UnixNano(), hex.EncodeToString(suffix))
+	return l.cache.AddToSet(ctx, key, member, l.policy.Window)
+}
+
+func (l *LoginLimiter) backoff(failures int) time.Duration {
+	if l.policy.BackoffBase <= 0 || failures < l.policy.BackoffAfter {
+		return 0
+	}
+
+	delay := l.policy.BackoffBase
+	for i := l.policy.BackoffAfter; i < failures && delay < l.policy.BackoffMax; i++ {
+		delay *= 2
+	}
+	return min(delay, l.policy.BackoffMax)
+}
+
+func normalizeAccount(account string) string {
+	return strings.ToLower(strings.TrimSpace(account))
+}
@@ -0,0 +1,208 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"go-chat/internals/adapters/cache"
+	"go-chat/internals/core/domain"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	Window:           15 * time.Minute,
+	BackoffAfter:     3,
+	BackoffBase:      time.Second,
+	BackoffMax:       8 * time.Second,
+	LockoutThreshold: 10,
+	LockoutDuration:  15 * time.Minute,
+	IPLimit:          20,
+}
+
+// newTestLimiter returns a limiter backed by the in-memory cache and a clock
+// that only moves when the returned function advances it.
+func newTestLimiter(t *testing.T, policy Policy) (*LoginLimiter, func(time.Duration)) {
+	t.Helper()
+
+	memoryCache := cache.NewMemoryCache()
+	t.Cleanup(func() { memoryCache.Close() })
+
+	now := time.Now()
+	limiter := NewLoginLimiter(memoryCache, policy)
+	limiter.now = func() time.Time { return now }
+	return limiter, func(d time.Duration) { now = now.Add(d) }
+}
+
+// fail records a failed login and fails the test if the limiter errs.
+func fail(t *testing.T, limiter *LoginLimiter, account, ip string) (time.Time, bool) {
+	t.Helper()
+
+	lockedUntil, locked, err := limiter.RecordFailure(context.Background(), account, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lockedUntil, locked
+}
+
+// rateLimited returns the error of Check as a RateLimitError, or nil if the login may go ahead.
+func rateLimited(t *testing.T, limiter *LoginLimiter, account, ip string) *domain.RateLimitError {
+	t.Helper()
+
+	err := limiter.Check(context.Background(), account, ip)
+	if err == nil {
+		return nil
+	}
+	var limitErr *domain.RateLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatal(err)
+	}
+	return limitErr
+}
+
+func TestBackoffDoublesPerFailure(t *testing.T) {
+	limiter, advance := newTestLimiter(t, testPolicy)
+
+	for i := 0; i < testPolicy.BackoffAfter-1; i++ {
+		fail(t, limiter, "alice@example.com", "")
+		if err := rateLimited(t, limiter, "alice@example.com", ""); err != nil {
+			t.Fatalf("failure %d: got a wait of %s before the backoff starts", i+1, err.RetryAfter)
+		}
+	}
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second} {
+		fail(t, limiter, "alice@example.com", "")
+		err := rateLimited(t, limiter, "alice@example.com", "")
+		if err == nil || err.RetryAfter != want || err.Locked {
+			t.Fatalf("got %+v, want a wait of %s", err, want)
+		}
+
+		advance(want)
+		if err := rateLimited(t, limiter, "alice@example.com", ""); err != nil {
+			t.Fatalf("still waiting %s after the backoff of %s", err.RetryAfter, want)
+		}
+	}
+
+	// The account is normalized, so case and spaces do not start a fresh count.
+	if err := rateLimited(t, limiter, " Alice@Example.com", ""); err != nil {
+		t.Fatalf("got a wait of %s for the same account", err.RetryAfter)
+	}
+	fail(t, limiter, " Alice@Example.com", "")
+	if err := rateLimited(t, limiter, "alice@example.com", ""); err == nil {
+		t.Fatal("a failure under another spelling of the account did not count")
+	}
+
+	// Another account is not slowed down.
+	if err := rateLimited(t, limiter, "bob@example.com", ""); err != nil {
+		t.Fatalf("got a wait of %s for an account without failures", err.RetryAfter)
+	}
+}
+
+func TestLockoutAtThreshold(t *testing.T) {
+	limiter, advance := newTestLimiter(t, testPolicy)
+
+	for i := 1; i < testPolicy.LockoutThreshold; i++ {
+		if _, locked := fail(t, limiter, "alice@example.com", ""); locked {
+			t.Fatalf("locked after %d failures, want %d", i, testPolicy.LockoutThreshold)
+		}
+	}
+
+	lockedUntil, locked := fail(t, limiter, "alice@example.com", "")
+	if !locked {
+		t.Fatalf("not locked after %d failures", testPolicy.LockoutThreshold)
+	}
+	err := rateLimited(t, limiter, "alice@example.com", "")
+	if err == nil || !err.Locked || err.RetryAfter != testPolicy.LockoutDuration {
+		t.Fatalf("got %+v, want a lock of %s", err, testPolicy.LockoutDuration)
+	}
+
+	advance(lockedUntil.Sub(limiter.now()))
+	if err := rateLimited(t, limiter, "alice@example.com", ""); err != nil {
+		t.Fatalf("still limited for %s once the lock ended", err.RetryAfter)
+	}
+
+	// The lock replaced the failures that led to it.
+	if _, locked := fail(t, limiter, "alice@example.com", ""); locked {
+		t.Fatal("locked again by the first failure after the lock")
+	}
+}
+
+func TestFailuresLeaveTheWindow(t *testing.T) {
+	limiter, advance := newTestLimiter(t, testPolicy)
+
+	for i := 1; i < testPolicy.LockoutThreshold; i++ {
+		fail(t, limiter, "alice@example.com", "")
+	}
+
+	advance(testPolicy.Window + time.Second)
+	if err := rateLimited(t, limiter, "alice@example.com", ""); err != nil {
+		t.Fatalf("got a wait of %s for failures outside the window", err.RetryAfter)
+	}
+	if _, locked := fail(t, limiter, "alice@example.com", ""); locked {
+		t.Fatal("failures outside the window counted towards the lockout")
+	}
+}
+
+func TestPerIPLimit(t *testing.T) {
+	policy := testPolicy
+	policy.BackoffBase = 0
+	policy.LockoutThreshold = 0
+	limiter, advance := newTestLimiter(t, policy)
+
+	// Spreading failures over many accounts does not get around the limit for the address.
+	for i := 0; i < policy.IPLimit; i++ {
+		if err := rateLimited(t, limiter, "", "192.0.2.1"); err != nil {
+			t.Fatalf("limited after %d failures, want %d", i, policy.IPLimit)
+		}
+		fail(t, limiter, string(rune('a'+i))+"@example.com", "192.0.2.1")
+		advance(time.Second)
+	}
+
+	err := rateLimited(t, limiter, "zed@example.com", "192.0.2.1")
+	if err == nil || err.Locked {
+		t.Fatalf("got %+v, want the address limited", err)
+	}
+	// The oldest failure is 20 seconds old and leaves the window first.
+	if want := policy.Window - time.Duration(policy.IPLimit)*time.Second; err.RetryAfter != want {
+		t.Fatalf("got a wait of %s, want %s", err.RetryAfter, want)
+	}
+
+	if err := rateLimited(t, limiter, "zed@example.com", "198.51.100.7"); err != nil {
+		t.Fatalf("got a wait of %s from another address", err.RetryAfter)
+	}
+
+	// A successful login clears the account but not the address.
+	if err := limiter.Reset(context.Background(), "a@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rateLimited(t, limiter, "a@example.com", "192.0.2.1"); err == nil {
+		t.Fatal("a successful login cleared the failures of the address")
+	}
+
+	advance(err.RetryAfter)
+	if err := rateLimited(t, limiter, "zed@example.com", "192.0.2.1"); err != nil {
+		t.Fatalf("still limited for %s once the oldest failure left the window", err.RetryAfter)
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	limiter, _ := newTestLimiter(t, testPolicy)
+
+	for i := 0; i < testPolicy.LockoutThreshold; i++ {
+		fail(t, limiter, "alice@example.com", "")
+	}
+	if err := rateLimited(t, limiter, "alice@example.com", ""); err == nil || !err.Locked {
+		t.Fatalf("got %+v, want the account locked", err)
+	}
+
+	if err := limiter.Unlock(context.Background(), "Alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rateLimited(t, limiter, "alice@example.com", ""); err != nil {
+		t.Fatalf("got a wait of %s after unlocking", err.RetryAfter)
+	}
+	// Unlocking also forgets the failures, so the next one does not back off.
+	fail(t, limiter, "alice@example.com", "")
+	if err := rateLimited(t, limiter, "alice@example.com", ""); err != nil {
+		t.Fatalf("got a wait of %s after one failure since the unlock", err.RetryAfter)
+	}
+}
@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go-chat/internals/core/domain"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func (k *DB) CreateServiceAccount(ctx context.Context, username string) (*domain.User, error) {
+	user := &domain.User{}
+	if err := k.db.WithContext(ctx).First(user, "username = ?", username).Error; err == nil {
+		return nil, domain.ErrUsernameTaken
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	account := &domain.User{Username: username, ServiceAccount: true}
+	if err := k.db.WithContext(ctx).Create(account).Error; err != nil {
+		return nil, fmt.Errorf("failed to create service account: %v", err)
+	}
+
+	return account, nil
+}
+
+// CreateAPIKey issues a key for the service account. The full key is returned
+// once; only its prefix and a hash of its secret are stored. The creator must
+// hold every scope, so managing keys does not amount to holding any permission.
+func (k *DB) CreateAPIKey(ctx context.Context, creatorID, serviceAccountID, name string, scopes []string, expiresAt *time.Time) (*domain.CreateAPIKeyResponse, error) {
+	account, err := k.findServiceAccount(ctx, serviceAccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := k.checkPermissionsExist(ctx, scopes); err != nil {
+		return nil, err
+	}
+	if err := k.checkHoldsScopes(ctx, creatorID, "api key creator", scopes); err != nil {
+		return nil, err
+	}
+
+	expiry := time.Now().Add(k.config.APIKeyExpiredIn)
+	if expiresAt != nil {
+		if !expiresAt.After(time.Now()) {
+			return nil, domain.ValidationError("expires_at must be in the future")
+		}
+		expiry = *expiresAt
+	}
+
+	prefix, err := randomHex(6)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey := &domain.APIKey{
+		ServiceAccountID: account.ID,
+		Name:             name,
+		Prefix:           prefix,
+		SecretHash:       hashAPIKeySecret(secret),
+		Scopes:           scopes,
+		ExpiresAt:        expiry,
+	}
+	if err := k.db.WithContext(ctx).Create(apiKey).Error; err != nil {
+		return nil, fmt.Errorf("failed to create api key: %v", err)
+	}
+
+	return &domain.CreateAPIKeyResponse{
+		APIKey: apiKey,
+		Key:    domain.APIKeyPrefix + prefix + "_" + secret,
+	}, nil
+}
+
+func (k *DB) ListAPIKeys(ctx context.Context, serviceAccountID string) ([]*domain.APIKey, error) {
+	account, err := k.findServiceAccount(ctx, serviceAccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var apiKeys []*domain.APIKey
+	if err := k.db.WithContext(ctx).Where("service_account_id = ?", account.ID).Order("created_at").Find(&apiKeys).Error; err != nil {
+		return nil, err
+	}
+
+	return apiKeys, nil
+}
+
+func (k *DB) RevokeAPIKey(ctx context.Context, apiKeyID string) error {
+	result := k.db.WithContext(ctx).Model(&domain.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", apiKeyID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// AuthenticateAPIKey checks a key presented as `Authorization: ApiKey <key>`
+// and returns claims describing its service account, scoped to the key.
+func (k *DB) AuthenticateAPIKey(ctx context.Context, key string) (*domain.JWTCustomClaims, error) {
+	prefix, secret, ok := strings.Cut(strings.TrimPrefix(key, domain.APIKeyPrefix), "_")
+	if !ok || !strings.HasPrefix(key, domain.APIKeyPrefix) {
+		return nil, domain.ErrAPIKeyInvalid
+	}
+
+	apiKey := &domain.APIKey{}
+	if err := k.db.WithContext(ctx).First(apiKey, "prefix = ?", prefix).Error; err != nil {
+		return nil, orMissing(err, domain.ErrAPIKeyInvalid)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey.SecretHash), []byte(hashAPIKeySecret(secret))) != 1 {
+		return nil, domain.ErrAPIKeyInvalid
+	}
+	if apiKey.RevokedAt != nil {
+		return nil, domain.ErrAPIKeyRevoked
+	}
+	if time.Now().After(apiKey.ExpiresAt) {
+		return nil, domain.ErrAPIKeyExpired
+	}
+
+	account, err := k.findServiceAccount(ctx, apiKey.ServiceAccountID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := k.db.WithContext(ctx).Model(apiKey).UpdateColumn("last_used_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+
+	return &domain.JWTCustomClaims{
+		UserID:   account.ID.String(),
+		Username: account.Username,
+		TokenUse: domain.TokenUseAPIKey,
+		Scope:    strings.Join(apiKey.Scopes, " "),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        apiKey.ID.String(),
+			Subject:   account.ID.String(),
+			ExpiresAt: jwt.NewNumericDate(apiKey.ExpiresAt),
+		},
+	}, nil
+}
+
+func (k *DB) findServiceAccount(ctx context.Context, serviceAccountID string) (*domain.User, error) {
+	if _, err := uuid.Parse(serviceAccountID); err != nil {
+		return nil, domain.ErrServiceAccountNotFound
+	}
+
+	account := &domain.User{}
+	if err := k.db.WithContext(ctx).First(account, "id = ? AND service_account", serviceAccountID).Error; err != nil {
+		return nil, orMissing(err, domain.ErrServiceAccountNotFound)
+	}
+
+	return account, nil
+}
+
+func (k *DB) checkPermissionsExist(ctx context.Context, names []string) error {
+	if len(names) == 0 {
+		return domain.ValidationError("at least one scope is required")
+	}
+
+	var found []string
+	if err := k.db.WithContext(ctx).Model(&domain.Permission{}).Where("name IN ?", names).Pluck("name", &found).Error; err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if !slices.Contains(found, name) {
+			return domain.ValidationError("unknown scope " + name)
+		}
+	}
+
+	return nil
+}
+
+// hashAPIKeySecret hashes the random part of a key. Like recovery codes it has
+// enough entropy that a fast hash protects it at rest.
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"go-chat/internals/core/domain"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+// ListAuditEvents returns events newest first. Pages are keyed on
+// (created_at, id) so events written while paging do not shift the results.
+func (a *DB) ListAuditEvents(ctx context.Context, filter *domain.AuditFilter) (*domain.AuditPage, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditPageSize
+	}
+	limit = min(limit, maxAuditPageSize)
+
+	query := a.db.WithContext(ctx).Model(&domain.AuditEvent{})
+	for column, value := range map[string]string{
+		"type":      filter.Type,
+		"actor_id":  filter.ActorID,
+		"target_id": filter.TargetID,
+		"outcome":   filter.Outcome,
+		"ip":        filter.IP,
+	} {
+		if value != "" {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	if filter.Since != nil {
+		query = query.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("created_at < ?", *filter.Until)
+	}
+	if filter.Cursor != "" {
+		createdAt, id, err := decodeAuditCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("(created_at, id) < (?, ?)", createdAt, id)
+	}
+
+	// Fetch one extra event to learn whether there is another page.
+	var events []*domain.AuditEvent
+	if err := query.Order("created_at DESC, id DESC").Limit(limit + 1).Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	page := &domain.AuditPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		last := page.Events[limit-1]
+		page.NextCursor = encodeAuditCursor(last.CreatedAt, last.ID)
+	}
+
+	return page, nil
+}
+
+func encodeAuditCursor(createdAt time.Time, id uuid.UUID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.UTC().Format(time.RFC3339Nano) + "|" + id.String()))
+}
+
+func decodeAuditCursor(cursor string) (time.Time, uuid.UUID, error) {
+	invalid := domain.ValidationError("invalid cursor")
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, invalid
+	}
+
+	timestamp, rawID, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, uuid.Nil, invalid
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return time.Time{}, uuid.Nil, invalid
+	}
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		return time.Time{}, uuid.Nil, invalid
+	}
+
+	return createdAt, id, nil
+}
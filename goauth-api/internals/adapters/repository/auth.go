@@ -1,17 +1,25 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"go-chat/internals/core/domain"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-func (a *DB) GetUserTokenByID(tokenID string) (string, error) {
+const (
+	userTokensPrefix = "user_tokens:"
+	tokenPairPrefix  = "token_pair:"
+)
+
+func (a *DB) GetUserTokenByID(ctx context.Context, tokenID string) (string, error) {
 	var userID string
-	err := a.cache.Get(tokenID, &userID)
+	err := a.cache.Get(ctx, tokenID, &userID)
 	if err != nil {
 		return "", err
 	}
@@ -19,34 +27,45 @@ func (a *DB) GetUserTokenByID(tokenID string) (string, error) {
 	return userID, nil
 }
 
-func (a *DB) GetUserByUsername(username string) (*domain.User, error) {
+func (a *DB) GetUserByUsername(ctx context.Context, username string) (*domain.User, error) {
 	user := &domain.User{}
-	result := a.db.First(&user)
-	if result.RowsAffected != 0 {
-		return nil, errors.New("user not found")
+	if err := a.db.WithContext(ctx).First(user, "username = ?", username).Error; err != nil {
+		return nil, orMissing(err, domain.ErrUserNotFound)
 	}
 
 	return user, nil
 }
 
-func (a *DB) generateToken(user *domain.User, jwtSecret string, duration time.Duration) (*domain.TokenDetails, error) {
-	expirationTime := time.Now().UTC().Add(duration)
-	tokenID := uuid.New().String()
+// generateToken signs a token with the active key. familyID ties access and
+// refresh tokens to the login they descend from and is empty for other tokens.
+func (a *DB) generateToken(user *domain.User, tokenUse, familyID string, duration time.Duration) (*domain.TokenDetails, error) {
+	return a.signToken(userClaims(user, tokenUse, familyID), duration)
+}
 
-	claims := domain.JWTCustomClaims{
+func userClaims(user *domain.User, tokenUse, familyID string) domain.JWTCustomClaims {
+	return domain.JWTCustomClaims{
 		UserID:   user.ID.String(),
 		Username: user.Username,
 		Email:    user.Email,
+		TokenUse: tokenUse,
+		FamilyID: familyID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ID:        tokenID,
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    user.ID.String(),
+			Issuer: user.ID.String(),
 		},
 	}
+}
+
+// signToken gives the claims a fresh token ID and lifetime and signs them with the active key.
+func (a *DB) signToken(claims domain.JWTCustomClaims, duration time.Duration) (*domain.TokenDetails, error) {
+	tokenID := uuid.New().String()
+	claims.ID = tokenID
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().UTC().Add(duration))
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(jwtSecret))
+	key := a.keyRing.Active()
+	token := jwt.NewWithClaims(key.SigningMethod(), claims)
+	token.Header["kid"] = key.ID
+	signedToken, err := token.SignedString(key.PrivateKey())
 	if err != nil {
 		return nil, err
 	}
@@ -54,34 +73,203 @@ func (a *DB) generateToken(user *domain.User, jwtSecret string, duration time.Du
 	tokenDetails := &domain.TokenDetails{
 		Token:     signedToken,
 		TokenID:   tokenID,
-		UserID:    user.ID.String(),
+		UserID:    claims.UserID,
 		ExpiresIn: duration.Nanoseconds(),
 	}
 
 	return tokenDetails, nil
 }
 
-func (a *DB) storeTokensInCache(userID string, accessTokenID, refreshTokenID string, accessTokenExp, refreshTokenExp time.Duration) error {
-	err := a.cache.Set(accessTokenID, userID, accessTokenExp)
+func (a *DB) ParseAccessToken(ctx context.Context, accessToken string) (*domain.JWTCustomClaims, error) {
+	return a.parseToken(accessToken, domain.TokenUseAccess)
+}
+
+// parseToken verifies the signature with the key named by the kid header and
+// checks that the token was issued for tokenUse.
+func (a *DB) parseToken(tokenString, tokenUse string) (*domain.JWTCustomClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &domain.JWTCustomClaims{}, a.keyRing.Keyfunc)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, domain.ErrTokenExpired
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrTokenInvalid, err)
+	}
+
+	claims, ok := token.Claims.(*domain.JWTCustomClaims)
+	if !ok || !token.Valid {
+		return nil, domain.ErrTokenInvalid
+	}
+
+	if claims.TokenUse != tokenUse {
+		return nil, fmt.Errorf("%w: expected %s token", domain.ErrTokenInvalid, tokenUse)
+	}
+
+	return claims, nil
+}
+
+func (a *DB) storeTokensInCache(ctx context.Context, userID string, accessTokenID, refreshTokenID string, accessTokenExp, refreshTokenExp time.Duration) error {
+	err := a.cache.Set(ctx, accessTokenID, userID, accessTokenExp)
 	if err != nil {
 		return err
 	}
 
-	err = a.cache.Set(refreshTokenID, userID, refreshTokenExp)
+	err = a.cache.Set(ctx, refreshTokenID, userID, refreshTokenExp)
 	if err != nil {
 		// If storing refresh token fails, delete the previously stored access token as well
-		a.cache.Delete(refreshTokenID)
+		a.cache.Delete(ctx, accessTokenID)
+		return err
+	}
+
+	// Index the token IDs per user so they can all be revoked at once.
+	indexKey := userTokensPrefix + userID
+	if err := a.cache.AddToSet(ctx, indexKey, accessTokenID, refreshTokenExp); err != nil {
+		return err
+	}
+	if err := a.cache.AddToSet(ctx, indexKey, refreshTokenID, refreshTokenExp); err != nil {
+		return err
+	}
+
+	// Link the pair so revoking either token revokes both.
+	if err := a.cache.Set(ctx, tokenPairPrefix+accessTokenID, refreshTokenID, accessTokenExp); err != nil {
+		return err
+	}
+	if err := a.cache.Set(ctx, tokenPairPrefix+refreshTokenID, accessTokenID, refreshTokenExp); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (a *DB) GetUserByID(userID string) (*domain.User, error) {
+// revokeTokenPair deletes the token together with the token issued alongside
+// it. If that ends the current refresh token of a login, the login is ended too.
+func (a *DB) revokeTokenPair(ctx context.Context, claims *domain.JWTCustomClaims) error {
+	subject, err := a.GetUserTokenByID(ctx, claims.ID)
+	if err != nil {
+		// Already revoked or expired.
+		return nil
+	}
+
+	tokenIDs := []string{claims.ID}
+	var pairedTokenID string
+	if err := a.cache.Get(ctx, tokenPairPrefix+claims.ID, &pairedTokenID); err == nil {
+		tokenIDs = append(tokenIDs, pairedTokenID)
+	}
+
+	for _, tokenID := range tokenIDs {
+		if err := a.cache.Delete(ctx, tokenID); err != nil {
+			return err
+		}
+		if err := a.cache.Delete(ctx, tokenPairPrefix+tokenID); err != nil {
+			return err
+		}
+		if !claims.IsClient() {
+			if err := a.cache.RemoveFromSet(ctx, userTokensPrefix+subject, tokenID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if claims.FamilyID == "" {
+		return nil
+	}
+
+	family := &refreshFamily{}
+	if err := a.cache.Get(ctx, refreshFamilyPrefix+claims.FamilyID, family); err != nil || !slices.Contains(tokenIDs, family.Current) {
+		return nil
+	}
+	if err := a.cache.Delete(ctx, refreshFamilyPrefix+claims.FamilyID); err != nil {
+		return err
+	}
+
+	return a.cache.RemoveFromSet(ctx, userSessionsPrefix+subject, claims.FamilyID)
+}
+
+// RevokeUserTokens ends every login of the user and deletes every access and
+// refresh token ID issued to them.
+func (a *DB) RevokeUserTokens(ctx context.Context, userID string) error {
+	sessionsKey := userSessionsPrefix + userID
+	familyIDs, err := a.cache.GetSetMembers(ctx, sessionsKey)
+	if err != nil {
+		return err
+	}
+	for _, familyID := range familyIDs {
+		if err := a.revokeRefreshFamily(ctx, familyID, userID); err != nil {
+			return err
+		}
+	}
+	if err := a.cache.Delete(ctx, sessionsKey); err != nil {
+		return err
+	}
+
+	indexKey := userTokensPrefix + userID
+	tokenIDs, err := a.cache.GetSetMembers(ctx, indexKey)
+	if err != nil {
+		return err
+	}
+
+	for _, tokenID := range tokenIDs {
+		if err := a.cache.Delete(ctx, tokenID); err != nil {
+			return err
+		}
+	}
+
+	return a.cache.Delete(ctx, indexKey)
+}
+
+// createSingleUseToken signs a token for user and records its ID under the token use until it expires.
+func (a *DB) createSingleUseToken(ctx context.Context, user *domain.User, tokenUse string, duration time.Duration) (string, error) {
+	tokenDetails, err := a.generateToken(user, tokenUse, "", duration)
+	if err != nil {
+		return "", err
+	}
+
+	if err := a.cache.Set(ctx, tokenUse+":"+tokenDetails.TokenID, tokenDetails.UserID, duration); err != nil {
+		return "", err
+	}
+
+	return tokenDetails.Token, nil
+}
+
+// consumeSingleUseToken validates a token created by createSingleUseToken and
+// removes it from the cache, returning the ID of the user it was issued to.
+// The lookup and removal are one step, so concurrent requests cannot both redeem it.
+func (a *DB) consumeSingleUseToken(ctx context.Context, tokenString, tokenUse string) (string, error) {
+	claims, err := a.parseToken(tokenString, tokenUse)
+	if err != nil {
+		return "", err
+	}
+
+	var userID string
+	if err := a.cache.Take(ctx, tokenUse+":"+claims.ID, &userID); err != nil {
+		return "", orMissing(err, domain.ErrSingleUseTokenUsed)
+	}
+
+	return userID, nil
+}
+
+// lookupSingleUseToken validates a token like consumeSingleUseToken but leaves it usable.
+func (a *DB) lookupSingleUseToken(ctx context.Context, tokenString, tokenUse string) (string, error) {
+	claims, err := a.parseToken(tokenString, tokenUse)
+	if err != nil {
+		return "", err
+	}
+
+	var userID string
+	if err := a.cache.Get(ctx, tokenUse+":"+claims.ID, &userID); err != nil {
+		return "", orMissing(err, domain.ErrSingleUseTokenUsed)
+	}
+
+	return userID, nil
+}
+
+func (a *DB) GetUserByID(ctx context.Context, userID string) (*domain.User, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, domain.ErrUserNotFound
+	}
+
 	user := &domain.User{}
-	result := a.db.First(&user, "id = ?", userID)
-	if result.RowsAffected == 0 {
-		return nil, errors.New("user not found")
+	if err := a.db.WithContext(ctx).First(user, "id = ?", userID).Error; err != nil {
+		return nil, orMissing(err, domain.ErrUserNotFound)
 	}
 	return user, nil
 }
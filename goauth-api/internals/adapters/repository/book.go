@@ -1,27 +1,238 @@
 package repository
 
 import (
+	"context"
+	"encoding/base64"
+	"fmt"
 	"go-chat/internals/core/domain"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultBookPageSize = 20
+	maxBookPageSize     = 100
 )
 
-func (b *DB) GetBooks() ([]*domain.Book, error) {
+type bookOrder struct {
+	column     string
+	descending bool
+}
+
+var bookOrders = map[string]bookOrder{
+	domain.BookSortCreatedAsc:  {"created_at", false},
+	domain.BookSortCreatedDesc: {"created_at", true},
+	domain.BookSortUpdatedAsc:  {"updated_at", false},
+	domain.BookSortUpdatedDesc: {"updated_at", true},
+}
+
+// GetBooks returns a page of books, either from an offset or after a cursor.
+// Cursors are keyed on (sort column, id), so books added while paging do not
+// shift the results the way they shift offsets.
+func (b *DB) GetBooks(ctx context.Context, filter *domain.BookFilter) (*domain.BookPage, error) {
+	sort := filter.Sort
+	if sort == "" {
+		sort = domain.BookSortCreatedDesc
+	}
+	order, ok := bookOrders[sort]
+	if !ok {
+		return nil, domain.ValidationError("sort must be one of created_at, -created_at, updated_at or -updated_at")
+	}
+	if filter.Cursor != "" && filter.Offset > 0 {
+		return nil, domain.ValidationError("cursor and offset cannot be combined")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultBookPageSize
+	}
+	limit = min(limit, maxBookPageSize)
+
+	query := b.db.WithContext(ctx).Model(&domain.Book{})
+	if filter.Deleted {
+		query = query.Where("deleted_at IS NOT NULL")
+	} else {
+		query = query.Where("deleted_at IS NULL")
+	}
+	if filter.Title != "" {
+		query = query.Where(`LOWER(title) LIKE ? ESCAPE '\'`, "%"+escapeLike(strings.ToLower(filter.Title))+"%")
+	}
+	// The filtered query is shared by the count and the page.
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	comparison, direction := ">", "ASC"
+	if order.descending {
+		comparison, direction = "<", "DESC"
+	}
+
+	page := query
+	if filter.Cursor != "" {
+		at, id, err := decodeBookCursor(filter.Cursor, sort)
+		if err != nil {
+			return nil, err
+		}
+		page = page.Where(fmt.Sprintf("(%s, id) %s (?, ?)", order.column, comparison), at, id)
+	}
+
+	// Fetch one extra book to learn whether there is another page.
 	var books []*domain.Book
-	result := b.db.Find(&books)
-	if result.Error != nil {
-		return nil, result.Error
+	if err := page.Order(order.column + " " + direction + ", id " + direction).Offset(filter.Offset).Limit(limit + 1).Find(&books).Error; err != nil {
+		return nil, err
+	}
+
+	result := &domain.BookPage{
+		Books: books,
+		Meta:  domain.BookPageMeta{Total: total, Limit: limit, Offset: filter.Offset},
+	}
+	if len(books) > limit {
+		result.Books = books[:limit]
+		last := result.Books[limit-1]
+		at := last.CreatedAt
+		if order.column == "updated_at" {
+			at = last.UpdatedAt
+		}
+		result.Meta.NextCursor = encodeBookCursor(sort, at, last.ID)
 	}
-	return books, nil
+
+	return result, nil
 }
 
-func (b *DB) CreateBook(title string) (*domain.Book, error) {
+func (b *DB) GetBook(ctx context.Context, id string) (*domain.Book, error) {
+	book, err := b.findBook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if book.DeletedAt != nil {
+		return nil, domain.ErrBookNotFound
+	}
+	return book, nil
+}
+
+func (b *DB) CreateBook(ctx context.Context, title string) (*domain.Book, error) {
 	book := &domain.Book{
 		Title: title,
 	}
 
-	result := b.db.Create(&book)
+	result := b.db.WithContext(ctx).Create(&book)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
 	return book, nil
 }
+
+func (b *DB) UpdateBook(ctx context.Context, id string, update *domain.BookUpdate) (*domain.Book, error) {
+	book, err := b.GetBook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]interface{}{}
+	if update.Title != nil {
+		if *update.Title == "" {
+			return nil, domain.ValidationError("title cannot be empty")
+		}
+		changes["title"] = *update.Title
+	}
+	if len(changes) == 0 {
+		return book, nil
+	}
+
+	if err := b.db.WithContext(ctx).Model(book).Updates(changes).Error; err != nil {
+		return nil, fmt.Errorf("failed to update book: %v", err)
+	}
+
+	return b.GetBook(ctx, id)
+}
+
+// DeleteBook only marks the book as deleted, so it can be restored.
+func (b *DB) DeleteBook(ctx context.Context, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return domain.ErrBookNotFound
+	}
+
+	result := b.db.WithContext(ctx).Model(&domain.Book{}).
+		Where("id = ? AND deleted_at IS NULL", id).
+		UpdateColumn("deleted_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrBookNotFound
+	}
+
+	return nil
+}
+
+func (b *DB) RestoreBook(ctx context.Context, id string) (*domain.Book, error) {
+	book, err := b.findBook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if book.DeletedAt == nil {
+		return nil, domain.ErrBookNotDeleted
+	}
+
+	if err := b.db.WithContext(ctx).Model(book).UpdateColumn("deleted_at", nil).Error; err != nil {
+		return nil, fmt.Errorf("failed to restore book: %v", err)
+	}
+	book.DeletedAt = nil
+
+	return book, nil
+}
+
+// findBook returns the book whether or not it is deleted.
+func (b *DB) findBook(ctx context.Context, id string) (*domain.Book, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, domain.ErrBookNotFound
+	}
+
+	book := &domain.Book{}
+	if err := b.db.WithContext(ctx).First(book, "id = ?", id).Error; err != nil {
+		return nil, orMissing(err, domain.ErrBookNotFound)
+	}
+	return book, nil
+}
+
+// A book cursor names the sort order it was made for, so it cannot be used with another.
+func encodeBookCursor(sort string, at time.Time, id uuid.UUID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(sort + "|" + at.UTC().Format(time.RFC3339Nano) + "|" + id.String()))
+}
+
+func decodeBookCursor(cursor, sort string) (time.Time, uuid.UUID, error) {
+	invalid := domain.ValidationError("invalid cursor")
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, invalid
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 || parts[0] != sort {
+		return time.Time{}, uuid.Nil, invalid
+	}
+
+	at, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return time.Time{}, uuid.Nil, invalid
+	}
+	id, err := uuid.Parse(parts[2])
+	if err != nil {
+		return time.Time{}, uuid.Nil, invalid
+	}
+
+	return at, id, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s, so it only matches itself.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -1,19 +1,43 @@
 package repository
 
 import (
-	"go-chat/internals/adapters/cache"
+	"errors"
+	"go-chat/internals/adapters/signing"
+	"go-chat/internals/config"
+	"go-chat/internals/core/ports"
+	"sync"
 
 	"gorm.io/gorm"
 )
 
 type DB struct {
-	db    *gorm.DB
-	cache *cache.RedisCache
+	db      *gorm.DB
+	cache   ports.CacheRepository
+	keyRing *signing.KeyRing
+	hasher  ports.PasswordHasher
+	policy  ports.PasswordPolicy
+	config  config.Config
+
+	dummyHash     string
+	dummyHashOnce sync.Once
 }
 
-func NewDB(db *gorm.DB, cache *cache.RedisCache) *DB {
+func NewDB(db *gorm.DB, cache ports.CacheRepository, keyRing *signing.KeyRing, hasher ports.PasswordHasher, policy ports.PasswordPolicy, config config.Config) *DB {
 	return &DB{
-		db:    db,
-		cache: cache,
+		db:      db,
+		cache:   cache,
+		keyRing: keyRing,
+		hasher:  hasher,
+		policy:  policy,
+		config:  config,
+	}
+}
+
+// orMissing returns missing if err reports an absent row or cache key, and err
+// otherwise, so that an outage is not mistaken for a record that does not exist.
+func orMissing(err, missing error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, ports.ErrCacheMiss) {
+		return missing
 	}
+	return err
 }
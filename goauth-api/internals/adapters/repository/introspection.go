@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"go-chat/internals/core/domain"
+	"net/http"
+)
+
+// IntrospectToken reports whether an access or refresh token is live, for
+// resource servers that cannot check it themselves. Only confidential clients
+// may ask, since the answer reveals who the token belongs to.
+func (o *DB) IntrospectToken(ctx context.Context, req *domain.IntrospectionRequest) (*domain.IntrospectionResponse, error) {
+	client, err := o.authenticateOAuthClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !client.Confidential {
+		return nil, &domain.OAuthError{Code: "invalid_client", Description: "only confidential clients may introspect tokens", Status: http.StatusUnauthorized}
+	}
+
+	if req.Token == "" {
+		return nil, &domain.OAuthError{Code: "invalid_request", Description: "token is required", Status: http.StatusBadRequest}
+	}
+
+	claims, tokenType, ok := o.parseAccessOrRefreshToken(req.Token, req.TokenTypeHint)
+	if !ok {
+		return &domain.IntrospectionResponse{Active: false}, nil
+	}
+
+	// A token is live for as long as the entry read by GetUserTokenByID exists.
+	subject, err := o.GetUserTokenByID(ctx, claims.ID)
+	if err != nil {
+		return &domain.IntrospectionResponse{Active: false}, nil
+	}
+
+	response := &domain.IntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Username:  claims.Username,
+		TokenType: tokenType,
+		ExpiresAt: claims.ExpiresAt.Unix(),
+		IssuedAt:  claims.IssuedAt.Unix(),
+		Subject:   subject,
+		Issuer:    o.issuer(),
+		TokenID:   claims.ID,
+	}
+
+	// Refresh tokens issued through the authorization code flow remember their client and scope.
+	if tokenType == domain.TokenTypeRefreshToken {
+		var grant oauthGrant
+		if err := o.cache.Get(ctx, oauthRefreshClientPrefix+claims.ID, &grant); err == nil {
+			response.ClientID = grant.ClientID
+			response.Scope = grant.Scope
+		}
+	}
+
+	return response, nil
+}
+
+// parseAccessOrRefreshToken tries the hinted token type first, as RFC 7662 suggests, then the other one.
+func (o *DB) parseAccessOrRefreshToken(token, hint string) (*domain.JWTCustomClaims, string, bool) {
+	tokenTypes := []string{domain.TokenTypeAccessToken, domain.TokenTypeRefreshToken}
+	if hint == domain.TokenTypeRefreshToken {
+		tokenTypes = []string{domain.TokenTypeRefreshToken, domain.TokenTypeAccessToken}
+	}
+
+	for _, tokenType := range tokenTypes {
+		tokenUse := domain.TokenUseAccess
+		if tokenType == domain.TokenTypeRefreshToken {
+			tokenUse = domain.TokenUseRefresh
+		}
+
+		if claims, err := o.parseToken(token, tokenUse); err == nil {
+			return claims, tokenType, true
+		}
+	}
+
+	return nil, "", false
+}
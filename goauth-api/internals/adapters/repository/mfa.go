@@ -0,0 +1,276 @@
+package repository
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go-chat/internals/adapters/totp"
+	"go-chat/internals/core/domain"
+	"strings"
+	"time"
+)
+
+const (
+	usedTOTPPrefix    = "totp_used:"
+	recoveryCodeCount = 10
+)
+
+func (m *DB) EnrollTOTP(ctx context.Context, userID string) (*domain.TOTPEnrollment, error) {
+	user, err := m.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		return nil, domain.ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedSecret, err := encryptSecret(secret, m.config.MFAEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.db.WithContext(ctx).Model(user).Update("totp_secret", encryptedSecret).Error; err != nil {
+		return nil, fmt.Errorf("failed to store totp secret: %v", err)
+	}
+
+	return &domain.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(m.config.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+func (m *DB) ConfirmTOTP(ctx context.Context, userID, code string) ([]string, error) {
+	user, err := m.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		return nil, domain.ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, domain.ErrMFAEnrollmentNotStarted
+	}
+
+	if err := m.verifyTOTP(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	codes, err := m.replaceRecoveryCodes(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.db.WithContext(ctx).Model(user).Update("totp_enabled", true).Error; err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %v", err)
+	}
+
+	return codes, nil
+}
+
+func (m *DB) DisableTOTP(ctx context.Context, userID, code string) error {
+	user, err := m.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !user.TOTPEnabled {
+		return domain.ErrMFANotEnabled
+	}
+
+	if err := m.verifySecondFactor(ctx, user, code); err != nil {
+		return err
+	}
+
+	if err := m.db.WithContext(ctx).Where("user_id = ?", user.ID).Delete(&domain.RecoveryCode{}).Error; err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %v", err)
+	}
+
+	return m.db.WithContext(ctx).Model(user).Updates(map[string]interface{}{
+		"totp_enabled": false,
+		"totp_secret":  "",
+	}).Error
+}
+
+// ConsumeMFAChallenge redeems the token issued by LoginUser and returns its user.
+// The challenge is consumed on every attempt, so a wrong code requires logging in again.
+func (m *DB) ConsumeMFAChallenge(ctx context.Context, mfaToken string) (*domain.User, error) {
+	userID, err := m.consumeSingleUseToken(ctx, mfaToken, domain.TokenUseMFAPending)
+	if err != nil {
+		return nil, orMissing(err, domain.ErrMFATokenInvalid)
+	}
+
+	return m.GetUserByID(ctx, userID)
+}
+
+// CompleteMFALogin logs the user in once the second factor checks out.
+func (m *DB) CompleteMFALogin(ctx context.Context, user *domain.User, code string, client domain.ClientInfo) (*domain.LoginResponse, error) {
+	if err := m.verifySecondFactor(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	return m.generateAndStoreTokens(ctx, user, client)
+}
+
+// createMFAChallenge issues the short-lived token returned by LoginUser when the user has 2FA enabled.
+func (m *DB) createMFAChallenge(ctx context.Context, user *domain.User) (*domain.LoginResponse, error) {
+	mfaToken, err := m.createSingleUseToken(ctx, user, domain.TokenUseMFAPending, m.config.MFATokenExpiredIn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.LoginResponse{
+		CommonModel: user.CommonModel,
+		Email:       user.Email,
+		Username:    user.Username,
+		MFARequired: true,
+		MFAToken:    mfaToken,
+	}, nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code.
+func (m *DB) verifySecondFactor(ctx context.Context, user *domain.User, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == 6 {
+		return m.verifyTOTP(ctx, user, code)
+	}
+	return m.useRecoveryCode(ctx, user, code)
+}
+
+func (m *DB) verifyTOTP(ctx context.Context, user *domain.User, code string) error {
+	secret, err := decryptSecret(user.TOTPSecret, m.config.MFAEncryptionKey)
+	if err != nil {
+		return err
+	}
+
+	if !totp.Validate(secret, code, time.Now()) {
+		return domain.ErrMFACodeInvalid
+	}
+
+	// Remember accepted codes for the validity window so they cannot be replayed.
+	// Claiming the code is one step, so concurrent requests cannot both use it.
+	claimed, err := m.cache.SetIfAbsent(ctx, usedTOTPPrefix+user.ID.String()+":"+code, true, 90*time.Second)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return domain.ErrMFACodeInvalid
+	}
+
+	return nil
+}
+
+func (m *DB) useRecoveryCode(ctx context.Context, user *domain.User, code string) error {
+	result := m.db.WithContext(ctx).Model(&domain.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrMFACodeInvalid
+	}
+	return nil
+}
+
+func (m *DB) replaceRecoveryCodes(ctx context.Context, user *domain.User) ([]string, error) {
+	if err := m.db.WithContext(ctx).Where("user_id = ?", user.ID).Delete(&domain.RecoveryCode{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %v", err)
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]domain.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, domain.RecoveryCode{UserID: user.ID, CodeHash: hashRecoveryCode(code)})
+	}
+
+	if err := m.db.WithContext(ctx).Create(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %v", err)
+	}
+
+	return codes, nil
+}
+
+func generateRecoveryCode() (string, error) {
+	raw := make([]byte, 6)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw))
+	return code[:5] + "-" + code[5:10], nil
+}
+
+// hashRecoveryCode normalizes the code so dashes, spaces and case do not matter.
+// Recovery codes are random, so a fast hash is enough to protect them at rest.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+func encryptSecret(secret, encodedKey string) (string, error) {
+	gcm, err := newSecretCipher(encodedKey)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptSecret(encrypted, encodedKey string) (string, error) {
+	gcm, err := newSecretCipher(encodedKey)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", errors.New("invalid encrypted totp secret")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	secret, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt totp secret")
+	}
+
+	return string(secret), nil
+}
+
+func newSecretCipher(encodedKey string) (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("MFA_ENCRYPTION_KEY must be a base64-encoded 32-byte key")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,555 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go-chat/internals/core/domain"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	oauthCodePrefix          = "oauth_code:"
+	oauthRefreshClientPrefix = "oauth_refresh_client:"
+)
+
+// oauthGrant records which client a refresh token was issued to and with what scope.
+type oauthGrant struct {
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"`
+	AuthTime int64  `json:"auth_time"`
+}
+
+func (o *DB) CreateOAuthClient(ctx context.Context, ownerID string, req *domain.CreateOAuthClientRequest) (*domain.OAuthClient, string, error) {
+	if req.Name == "" {
+		return nil, "", domain.ValidationError("client name is required")
+	}
+
+	grantTypes := req.GrantTypes
+	if len(grantTypes) == 0 {
+		grantTypes = []string{domain.GrantTypeAuthorizationCode, domain.GrantTypeRefreshToken}
+	}
+	for _, grantType := range grantTypes {
+		switch grantType {
+		case domain.GrantTypeAuthorizationCode, domain.GrantTypeRefreshToken, domain.GrantTypeClientCredentials:
+		default:
+			return nil, "", domain.ValidationError(fmt.Sprintf("unsupported grant type %q", grantType))
+		}
+	}
+
+	if slices.Contains(grantTypes, domain.GrantTypeAuthorizationCode) && len(req.RedirectURIs) == 0 {
+		return nil, "", domain.ValidationError("at least one redirect uri is required")
+	}
+	for _, redirectURI := range req.RedirectURIs {
+		parsed, err := url.Parse(redirectURI)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+			return nil, "", domain.ValidationError(fmt.Sprintf("invalid redirect uri %q", redirectURI))
+		}
+	}
+
+	owner, err := uuid.Parse(ownerID)
+	if err != nil {
+		return nil, "", domain.ErrUserNotFound
+	}
+
+	if slices.Contains(grantTypes, domain.GrantTypeClientCredentials) {
+		if !req.Confidential {
+			return nil, "", domain.ValidationError("client_credentials requires a confidential client")
+		}
+		// A client acting for itself must not be able to do more than the user who registered it.
+		if err := o.checkHoldsScopes(ctx, ownerID, "client owner", req.Scopes); err != nil {
+			return nil, "", err
+		}
+	} else if len(req.Scopes) > 0 {
+		return nil, "", domain.ValidationError("scopes can only be registered for client_credentials clients")
+	}
+
+	client := &domain.OAuthClient{
+		ClientID:     uuid.New().String(),
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		Confidential: req.Confidential,
+		OwnerID:      owner,
+		GrantTypes:   grantTypes,
+		Scopes:       req.Scopes,
+	}
+
+	var secret string
+	if req.Confidential {
+		secret, err = randomToken()
+		if err != nil {
+			return nil, "", err
+		}
+		client.SecretHash, err = o.hasher.Hash(secret)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := o.db.WithContext(ctx).Create(client).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create oauth client: %v", err)
+	}
+
+	return client, secret, nil
+}
+
+// Authorize issues an authorization code for the logged in user and returns the URL to redirect the
+// user agent to. Errors that can be reported to the client are encoded into that URL; an error is only
+// returned when the client or redirect URI cannot be trusted, in which case the caller must not redirect.
+// Unless the user owns the client or has already agreed to give it the requested scope, no code is
+// issued until they answer the returned consent prompt. sessionID names the login the user is
+// authorizing from, which began when they last authenticated.
+func (o *DB) Authorize(ctx context.Context, userID, sessionID string, req *domain.AuthorizationRequest) (*domain.AuthorizationResult, error) {
+	client, err := o.findOAuthClient(ctx, req.ClientID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, &domain.OAuthError{Code: "invalid_client", Description: "unknown client", Status: http.StatusBadRequest}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	redirectURI, ok := matchRedirectURI(client, req.RedirectURI)
+	if !ok {
+		return nil, &domain.OAuthError{Code: "invalid_request", Description: "redirect_uri is not registered for this client", Status: http.StatusBadRequest}
+	}
+	redirect := func(params url.Values) *domain.AuthorizationResult {
+		return &domain.AuthorizationResult{RedirectURL: authorizationRedirect(redirectURI, req.State, params)}
+	}
+
+	if !allowsGrantType(client, domain.GrantTypeAuthorizationCode) {
+		return redirect(url.Values{"error": {"unauthorized_client"}}), nil
+	}
+
+	if req.ResponseType != "code" {
+		return redirect(url.Values{"error": {"unsupported_response_type"}}), nil
+	}
+
+	if req.CodeChallengeMethod != "S256" || !isCodeChallenge(req.CodeChallenge) {
+		return redirect(url.Values{
+			"error":             {"invalid_request"},
+			"error_description": {"PKCE with code_challenge_method S256 is required"},
+		}), nil
+	}
+
+	for _, scope := range strings.Fields(req.Scope) {
+		if !slices.Contains(supportedScopes(), scope) {
+			return redirect(url.Values{
+				"error":             {"invalid_scope"},
+				"error_description": {fmt.Sprintf("scope %s is not supported", scope)},
+			}), nil
+		}
+	}
+
+	switch req.Consent {
+	case "":
+		if client.OwnerID.String() != userID {
+			consented, err := o.hasConsent(ctx, userID, client.ClientID, req.Scope)
+			if err != nil {
+				return nil, err
+			}
+			if !consented {
+				return &domain.AuthorizationResult{Consent: &domain.ConsentPrompt{
+					ClientID:   client.ClientID,
+					ClientName: client.Name,
+					Scope:      req.Scope,
+				}}, nil
+			}
+		}
+	case domain.ConsentApprove:
+		if err := o.recordConsent(ctx, userID, client.ClientID, req.Scope); err != nil {
+			return nil, err
+		}
+	case domain.ConsentDeny:
+		return redirect(url.Values{"error": {"access_denied"}}), nil
+	default:
+		return redirect(url.Values{
+			"error":             {"invalid_request"},
+			"error_description": {"consent must be approve or deny"},
+		}), nil
+	}
+
+	// OIDC reports when the user logged in as auth_time. Refreshing tokens
+	// keeps the login, so this is when the refresh family was started.
+	family := &refreshFamily{}
+	if err := o.cache.Get(ctx, refreshFamilyPrefix+sessionID, family); err != nil {
+		return nil, orMissing(err, &domain.OAuthError{Code: "login_required", Description: "the login has ended", Status: http.StatusUnauthorized})
+	}
+
+	code, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	authorizationCode := domain.AuthorizationCode{
+		ClientID:      client.ClientID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         req.Scope,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		AuthTime:      family.CreatedAt.Unix(),
+	}
+	if err := o.cache.Set(ctx, oauthCodePrefix+code, authorizationCode, o.config.OAuthCodeExpiredIn); err != nil {
+		return nil, err
+	}
+
+	return redirect(url.Values{"code": {code}}), nil
+}
+
+// hasConsent reports whether the user has already agreed to give the client every scope in scope.
+func (o *DB) hasConsent(ctx context.Context, userID, clientID, scope string) (bool, error) {
+	consent := &domain.OAuthConsent{}
+	err := o.db.WithContext(ctx).First(consent, "user_id = ? AND client_id = ?", userID, clientID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	granted := strings.Fields(consent.Scope)
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(granted, s) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// recordConsent adds scope to what the user has agreed to give the client.
+func (o *DB) recordConsent(ctx context.Context, userID, clientID, scope string) error {
+	user, err := uuid.Parse(userID)
+	if err != nil {
+		return domain.ErrUserNotFound
+	}
+
+	consent := &domain.OAuthConsent{}
+	err = o.db.WithContext(ctx).Where(domain.OAuthConsent{UserID: user, ClientID: clientID}).FirstOrInit(consent).Error
+	if err != nil {
+		return err
+	}
+
+	granted := strings.Fields(consent.Scope)
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(granted, s) {
+			granted = append(granted, s)
+		}
+	}
+	consent.Scope = strings.Join(granted, " ")
+
+	if err := o.db.WithContext(ctx).Save(consent).Error; err != nil {
+		return fmt.Errorf("failed to record consent: %v", err)
+	}
+	return nil
+}
+
+func (o *DB) ExchangeToken(ctx context.Context, req *domain.TokenRequest, clientInfo domain.ClientInfo) (*domain.TokenResponse, error) {
+	client, err := o.authenticateOAuthClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.GrantType {
+	case domain.GrantTypeAuthorizationCode, domain.GrantTypeRefreshToken, domain.GrantTypeClientCredentials:
+	default:
+		return nil, &domain.OAuthError{Code: "unsupported_grant_type", Status: http.StatusBadRequest}
+	}
+
+	if !allowsGrantType(client, req.GrantType) {
+		return nil, &domain.OAuthError{Code: "unauthorized_client", Description: "client is not allowed to use this grant type", Status: http.StatusBadRequest}
+	}
+
+	switch req.GrantType {
+	case domain.GrantTypeAuthorizationCode:
+		return o.exchangeAuthorizationCode(ctx, client, req, clientInfo)
+	case domain.GrantTypeRefreshToken:
+		return o.exchangeRefreshToken(ctx, client, req, clientInfo)
+	default:
+		return o.exchangeClientCredentials(ctx, client, req)
+	}
+}
+
+func (o *DB) exchangeAuthorizationCode(ctx context.Context, client *domain.OAuthClient, req *domain.TokenRequest, clientInfo domain.ClientInfo) (*domain.TokenResponse, error) {
+	// Codes are single use, so take it before anything else can fail.
+	var authorizationCode domain.AuthorizationCode
+	if err := o.cache.Take(ctx, oauthCodePrefix+req.Code, &authorizationCode); err != nil {
+		return nil, orMissing(err, invalidGrant("authorization code is invalid or has expired"))
+	}
+
+	if authorizationCode.ClientID != client.ClientID {
+		return nil, invalidGrant("authorization code was issued to another client")
+	}
+	if authorizationCode.RedirectURI != req.RedirectURI {
+		return nil, invalidGrant("redirect_uri does not match the authorization request")
+	}
+	if !verifyCodeChallenge(authorizationCode.CodeChallenge, req.CodeVerifier) {
+		return nil, invalidGrant("code_verifier does not match the code challenge")
+	}
+
+	user, err := o.GetUserByID(ctx, authorizationCode.UserID)
+	if err != nil {
+		return nil, invalidGrant("user no longer exists")
+	}
+
+	// Name the session after the client, since the login happened on its behalf.
+	if clientInfo.DeviceLabel == "" {
+		clientInfo.DeviceLabel = client.Name
+	}
+	grant := oauthGrant{ClientID: client.ClientID, Scope: authorizationCode.Scope, AuthTime: authorizationCode.AuthTime}
+	tokens, err := o.startLogin(ctx, user, clientInfo, &grant)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.oauthTokenResponse(ctx, user, tokens, grant, authorizationCode.Nonce)
+}
+
+func (o *DB) exchangeRefreshToken(ctx context.Context, client *domain.OAuthClient, req *domain.TokenRequest, clientInfo domain.ClientInfo) (*domain.TokenResponse, error) {
+	claims, err := o.parseRefreshToken(req.RefreshToken)
+	if err != nil {
+		return nil, invalidGrant(err.Error())
+	}
+
+	var grant oauthGrant
+	if err := o.cache.Get(ctx, oauthRefreshClientPrefix+claims.ID, &grant); err != nil || grant.ClientID != client.ClientID {
+		return nil, invalidGrant("refresh token was not issued to this client")
+	}
+
+	// The binding of the rotated token is left to expire so a concurrent retry
+	// within the reuse grace window still passes the check above.
+	tokens, err := o.RefreshTokens(ctx, req.RefreshToken, clientInfo)
+	if err != nil {
+		grantErr := invalidGrant(err.Error())
+		grantErr.Err = err
+		return nil, grantErr
+	}
+
+	user, err := o.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, invalidGrant("user no longer exists")
+	}
+
+	return o.oauthTokenResponse(ctx, user, tokens, grant, "")
+}
+
+// exchangeClientCredentials issues an access token to the client itself. The
+// token has no user and no refresh token; the client asks again when it expires.
+func (o *DB) exchangeClientCredentials(ctx context.Context, client *domain.OAuthClient, req *domain.TokenRequest) (*domain.TokenResponse, error) {
+	scopes := client.Scopes
+	if req.Scope != "" {
+		scopes = strings.Fields(req.Scope)
+		for _, scope := range scopes {
+			if !slices.Contains(client.Scopes, scope) {
+				return nil, &domain.OAuthError{Code: "invalid_scope", Description: fmt.Sprintf("scope %s is not registered for this client", scope), Status: http.StatusBadRequest}
+			}
+		}
+	}
+
+	// The owner may have lost permissions since the client was registered.
+	if err := o.checkHoldsScopes(ctx, client.OwnerID.String(), "client owner", scopes); err != nil {
+		return nil, &domain.OAuthError{Code: "invalid_scope", Description: err.Error(), Status: http.StatusBadRequest}
+	}
+
+	scope := strings.Join(scopes, " ")
+	claims := domain.JWTCustomClaims{
+		ClientID: client.ClientID,
+		TokenUse: domain.TokenUseAccess,
+		Scope:    scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: client.ClientID,
+			Issuer:  client.ClientID,
+		},
+	}
+	token, err := o.signToken(claims, o.config.AccessTokenExpiredIn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.cache.Set(ctx, token.TokenID, client.ClientID, o.config.AccessTokenExpiredIn); err != nil {
+		return nil, err
+	}
+
+	return &domain.TokenResponse{
+		AccessToken: token.Token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(o.config.AccessTokenExpiredIn.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// oauthTokenResponse binds the new refresh token to the client so only that client can redeem it,
+// and adds an ID token when the openid scope was granted.
+func (o *DB) oauthTokenResponse(ctx context.Context, user *domain.User, tokens *domain.LoginResponse, grant oauthGrant, nonce string) (*domain.TokenResponse, error) {
+	claims, err := o.parseRefreshToken(tokens.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.cache.Set(ctx, oauthRefreshClientPrefix+claims.ID, grant, o.config.RefreshTokenExpiredIn); err != nil {
+		return nil, err
+	}
+
+	response := &domain.TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(o.config.AccessTokenExpiredIn.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		Scope:        grant.Scope,
+	}
+
+	if hasScope(grant.Scope, "openid") {
+		response.IDToken, err = o.generateIDToken(user, grant.ClientID, grant.Scope, nonce, grant.AuthTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+func (o *DB) authenticateOAuthClient(ctx context.Context, clientID, clientSecret string) (*domain.OAuthClient, error) {
+	client, err := o.findOAuthClient(ctx, clientID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, &domain.OAuthError{Code: "invalid_client", Description: "client authentication failed", Status: http.StatusUnauthorized}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Confidential {
+		if ok, _, err := o.hasher.Verify(client.SecretHash, clientSecret); err != nil || !ok {
+			return nil, &domain.OAuthError{Code: "invalid_client", Description: "client authentication failed", Status: http.StatusUnauthorized}
+		}
+	}
+
+	return client, nil
+}
+
+func (o *DB) GetOAuthClient(ctx context.Context, clientID string) (*domain.OAuthClient, error) {
+	return o.findOAuthClient(ctx, clientID)
+}
+
+func (o *DB) findOAuthClient(ctx context.Context, clientID string) (*domain.OAuthClient, error) {
+	client := &domain.OAuthClient{}
+	if err := o.db.WithContext(ctx).First(client, "client_id = ?", clientID).Error; err != nil {
+		return nil, orMissing(err, domain.ErrOAuthClientNotFound)
+	}
+	return client, nil
+}
+
+func (o *DB) checkHoldsScopes(ctx context.Context, userID, holder string, scopes []string) error {
+	granted, err := o.GetUserPermissions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			return domain.NewError(domain.ErrForbidden, domain.ErrPermissionDenied.Code, holder+" does not hold permission "+scope)
+		}
+	}
+
+	return nil
+}
+
+func allowsGrantType(client *domain.OAuthClient, grantType string) bool {
+	if len(client.GrantTypes) == 0 {
+		return grantType == domain.GrantTypeAuthorizationCode || grantType == domain.GrantTypeRefreshToken
+	}
+	return slices.Contains(client.GrantTypes, grantType)
+}
+
+// matchRedirectURI requires an exact match, falling back to the only registered URI when none is given.
+// The URI it returns is where to redirect; the code keeps the parameter as sent.
+func matchRedirectURI(client *domain.OAuthClient, redirectURI string) (string, bool) {
+	if redirectURI == "" {
+		if len(client.RedirectURIs) == 1 {
+			return client.RedirectURIs[0], true
+		}
+		return "", false
+	}
+
+	for _, registered := range client.RedirectURIs {
+		if registered == redirectURI {
+			return redirectURI, true
+		}
+	}
+	return "", false
+}
+
+func authorizationRedirect(redirectURI, state string, params url.Values) string {
+	if state != "" {
+		params.Set("state", state)
+	}
+
+	parsed, _ := url.Parse(redirectURI)
+	query := parsed.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	parsed.RawQuery = query.Encode()
+
+	return parsed.String()
+}
+
+// supportedScopes are the OpenID Connect scopes and the permissions a user can give a client.
+func supportedScopes() []string {
+	scopes := []string{"openid", "email", "profile"}
+	for _, permission := range defaultPermissions {
+		scopes = append(scopes, permission.Name)
+	}
+	return scopes
+}
+
+// isCodeChallenge reports whether challenge is an S256 code challenge: a
+// base64url SHA-256 digest without padding.
+func isCodeChallenge(challenge string) bool {
+	decoded, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(decoded) == sha256.Size
+}
+
+// isCodeVerifier reports whether verifier has the length and characters RFC 7636 section 4.1 requires.
+func isCodeVerifier(verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, r := range verifier {
+		unreserved := r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || strings.ContainsRune("-._~", r)
+		if !unreserved {
+			return false
+		}
+	}
+	return true
+}
+
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if !isCodeVerifier(verifier) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func invalidGrant(description string) *domain.OAuthError {
+	return &domain.OAuthError{Code: "invalid_grant", Description: description, Status: http.StatusBadRequest}
+}
+
+func randomToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"go-chat/internals/core/domain"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func (o *DB) OpenIDConfiguration(ctx context.Context) (*domain.OpenIDConfiguration, error) {
+	issuer := o.issuer()
+	return &domain.OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{domain.GrantTypeAuthorizationCode, domain.GrantTypeRefreshToken, domain.GrantTypeClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  o.keyRing.Algorithms(),
+		ScopesSupported:                   supportedScopes(),
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified", "preferred_username"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+	}, nil
+}
+
+func (o *DB) JWKS(ctx context.Context) (*domain.JSONWebKeySet, error) {
+	keySet := o.keyRing.JWKS()
+	return &keySet, nil
+}
+
+// UserInfo returns the claims about the user that scope grants.
+func (o *DB) UserInfo(ctx context.Context, userID, scope string) (*domain.UserInfo, error) {
+	user, err := o.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	email, emailVerified, username := profileClaims(user, scope)
+	return &domain.UserInfo{
+		Subject:           user.ID.String(),
+		Email:             email,
+		EmailVerified:     emailVerified,
+		PreferredUsername: username,
+	}, nil
+}
+
+func (o *DB) generateIDToken(user *domain.User, clientID, scope, nonce string, authTime int64) (string, error) {
+	now := time.Now()
+	email, emailVerified, username := profileClaims(user, scope)
+	claims := domain.IDTokenClaims{
+		Email:             email,
+		EmailVerified:     emailVerified,
+		PreferredUsername: username,
+		Nonce:             nonce,
+		AuthTime:          authTime,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    o.issuer(),
+			Subject:   user.ID.String(),
+			Audience:  jwt.ClaimStrings{clientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(o.config.IDTokenExpiredIn)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	key := o.keyRing.Active()
+	token := jwt.NewWithClaims(key.SigningMethod(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey())
+}
+
+// issuer is the issuer identifier published by discovery, which ID tokens
+// and introspection responses must match.
+func (o *DB) issuer() string {
+	return strings.TrimSuffix(o.config.OIDCIssuer, "/")
+}
+
+// profileClaims returns the email claims if scope holds email and the
+// username if it holds profile, leaving the others empty.
+func profileClaims(user *domain.User, scope string) (string, *bool, string) {
+	var email, username string
+	var emailVerified *bool
+	if hasScope(scope, "email") {
+		verified := user.VerifiedAt != nil
+		email, emailVerified = user.Email, &verified
+	}
+	if hasScope(scope, "profile") {
+		username = user.Username
+	}
+	return email, emailVerified, username
+}
+
+func hasScope(scope, want string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
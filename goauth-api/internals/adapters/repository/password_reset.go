@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"go-chat/internals/core/domain"
+)
+
+func (p *DB) CreatePasswordResetToken(ctx context.Context, user *domain.User) (string, error) {
+	return p.createSingleUseToken(ctx, user, domain.TokenUsePasswordReset, p.config.PasswordResetTokenExpiredIn)
+}
+
+func (p *DB) ResetPassword(ctx context.Context, token, newPassword string) (*domain.User, error) {
+	userID, err := p.lookupSingleUseToken(ctx, token, domain.TokenUsePasswordReset)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := p.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the policy before using up the token, so the user can retry with a better password.
+	if err := p.policy.Check(newPassword, user.Email, user.Username); err != nil {
+		return nil, err
+	}
+
+	if _, err := p.consumeSingleUseToken(ctx, token, domain.TokenUsePasswordReset); err != nil {
+		return nil, err
+	}
+
+	if err := p.storePassword(ctx, user, newPassword); err != nil {
+		return nil, err
+	}
+
+	if err := p.RevokeUserTokens(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
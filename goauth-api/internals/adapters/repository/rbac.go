@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"go-chat/internals/core/domain"
+)
+
+var defaultPermissions = []domain.Permission{
+	{Name: domain.PermissionBooksRead, Description: "List and read books"},
+	{Name: domain.PermissionBooksWrite, Description: "Create, change, delete and restore books"},
+	{Name: domain.PermissionRolesManage, Description: "Assign and remove user roles"},
+	{Name: domain.PermissionAPIKeysManage, Description: "Create service accounts and manage their API keys"},
+	{Name: domain.PermissionUsersUnlock, Description: "Lift login lockouts"},
+	{Name: domain.PermissionAuditRead, Description: "Read the security audit log"},
+	{Name: domain.PermissionOAuthClientsManage, Description: "Register OAuth clients"},
+}
+
+var defaultRoles = map[string][]string{
+	domain.RoleAdmin:  {domain.PermissionBooksRead, domain.PermissionBooksWrite, domain.PermissionRolesManage, domain.PermissionAPIKeysManage, domain.PermissionUsersUnlock, domain.PermissionAuditRead, domain.PermissionOAuthClientsManage},
+	domain.RoleEditor: {domain.PermissionBooksRead, domain.PermissionBooksWrite},
+	domain.RoleUser:   {domain.PermissionBooksRead},
+}
+
+// SeedRoles creates the default roles and permissions if they are missing and
+// gives RoleUser to every user that has no role yet, such as those created
+// before roles existed. Service accounts are left alone; their API key scopes
+// decide what they may do.
+func (r *DB) SeedRoles(ctx context.Context) error {
+	permissions := make(map[string]domain.Permission, len(defaultPermissions))
+	for _, permission := range defaultPermissions {
+		if err := r.db.WithContext(ctx).Where(domain.Permission{Name: permission.Name}).FirstOrCreate(&permission).Error; err != nil {
+			return err
+		}
+		permissions[permission.Name] = permission
+	}
+
+	for name, permissionNames := range defaultRoles {
+		role := domain.Role{Name: name}
+		if err := r.db.WithContext(ctx).Where(domain.Role{Name: name}).FirstOrCreate(&role).Error; err != nil {
+			return err
+		}
+
+		rolePermissions := make([]domain.Permission, 0, len(permissionNames))
+		for _, permissionName := range permissionNames {
+			rolePermissions = append(rolePermissions, permissions[permissionName])
+		}
+		if err := r.db.WithContext(ctx).Model(&role).Association("Permissions").Append(rolePermissions); err != nil {
+			return err
+		}
+	}
+
+	role, err := r.findRole(ctx, domain.RoleUser)
+	if err != nil {
+		return err
+	}
+
+	return r.db.WithContext(ctx).Exec(`INSERT INTO user_roles (user_id, role_id)
+		SELECT users.id, ? FROM users
+		WHERE NOT users.service_account
+		AND NOT EXISTS (SELECT 1 FROM user_roles WHERE user_roles.user_id = users.id)`, role.ID).Error
+}
+
+// GetUserPermissions returns the names of all permissions granted to the user through their roles.
+func (r *DB) GetUserPermissions(ctx context.Context, userID string) ([]string, error) {
+	var permissions []string
+	err := r.db.WithContext(ctx).Model(&domain.Permission{}).
+		Distinct("permissions.name").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN user_roles ON user_roles.role_id = role_permissions.role_id").
+		Where("user_roles.user_id = ?", userID).
+		Pluck("permissions.name", &permissions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func (r *DB) ListRoles(ctx context.Context) ([]*domain.Role, error) {
+	var roles []*domain.Role
+	if err := r.db.WithContext(ctx).Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (r *DB) GetUserRoles(ctx context.Context, userID string) ([]*domain.Role, error) {
+	user, err := r.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []*domain.Role
+	if err := r.db.WithContext(ctx).Model(user).Preload("Permissions").Association("Roles").Find(&roles); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (r *DB) AssignRole(ctx context.Context, userID, roleName string) error {
+	user, err := r.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	role, err := r.findRole(ctx, roleName)
+	if err != nil {
+		return err
+	}
+
+	return r.db.WithContext(ctx).Model(user).Association("Roles").Append(role)
+}
+
+func (r *DB) RemoveRole(ctx context.Context, userID, roleName string) error {
+	user, err := r.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	role, err := r.findRole(ctx, roleName)
+	if err != nil {
+		return err
+	}
+
+	// Refuse to remove the last admin, which would leave nobody able to manage roles.
+	if role.Name == domain.RoleAdmin {
+		var otherAdmins int64
+		if err := r.db.WithContext(ctx).Table("user_roles").Where("role_id = ? AND user_id <> ?", role.ID, user.ID).Count(&otherAdmins).Error; err != nil {
+			return err
+		}
+		if otherAdmins == 0 {
+			return domain.ErrLastAdmin
+		}
+	}
+
+	return r.db.WithContext(ctx).Model(user).Association("Roles").Delete(role)
+}
+
+func (r *DB) findRole(ctx context.Context, name string) (*domain.Role, error) {
+	role := &domain.Role{}
+	if err := r.db.WithContext(ctx).First(role, "name = ?", name).Error; err != nil {
+		return nil, orMissing(err, domain.ErrRoleNotFound)
+	}
+
+	return role, nil
+}
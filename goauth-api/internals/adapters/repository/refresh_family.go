@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go-chat/internals/core/domain"
+	"time"
+)
+
+const (
+	refreshFamilyPrefix       = "refresh_family:"
+	refreshFamilyTokensPrefix = "refresh_family_tokens:"
+	refreshFamilyGracePrefix  = "refresh_family_grace:"
+)
+
+// refreshFamily tracks the refresh tokens descending from one login. Only the
+// current token may be rotated; presenting any older one means it was copied.
+type refreshFamily struct {
+	UserID      string    `json:"user_id"`
+	Current     string    `json:"current"`
+	Previous    string    `json:"previous,omitempty"`
+	RotatedAt   time.Time `json:"rotated_at"`
+	DeviceLabel string    `json:"device_label"`
+	IP          string    `json:"ip"`
+	UserAgent   string    `json:"user_agent"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastUsedAt  time.Time `json:"last_used_at"`
+	// Grant is set on logins the user gave an OAuth client.
+	Grant *oauthGrant `json:"grant,omitempty"`
+}
+
+// refreshGrace is the result of the latest rotation, handed out again to
+// concurrent requests that present the previous token within the grace window.
+type refreshGrace struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// errRotatedMeanwhile reports that a concurrent request rotated the presented token first.
+var errRotatedMeanwhile = errors.New("refresh token rotated by a concurrent request")
+
+func (u *DB) RefreshTokens(ctx context.Context, refreshToken string, client domain.ClientInfo) (*domain.LoginResponse, error) {
+	claims, err := u.parseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.FamilyID == "" {
+		return nil, domain.ErrRefreshTokenInvalid
+	}
+	family := &refreshFamily{}
+	if err := u.cache.Get(ctx, refreshFamilyPrefix+claims.FamilyID, family); err != nil {
+		return nil, orMissing(err, domain.ErrRefreshTokenInvalid)
+	}
+
+	if claims.ID == family.Current {
+		tokens, err := u.rotateRefreshToken(ctx, claims, family, client)
+		if !errors.Is(err, errRotatedMeanwhile) {
+			return tokens, err
+		}
+	}
+
+	if claims.ID == family.Previous {
+		var grace refreshGrace
+		if err := u.cache.Get(ctx, refreshFamilyGracePrefix+family.Current, &grace); err == nil {
+			return u.graceTokens(ctx, family.UserID, &grace)
+		}
+	}
+
+	if err := u.revokeRefreshFamily(ctx, claims.FamilyID, family.UserID); err != nil {
+		return nil, err
+	}
+
+	return nil, &domain.RefreshTokenReuseError{UserID: family.UserID, FamilyID: claims.FamilyID, TokenID: claims.ID}
+}
+
+// rotateRefreshToken replaces the family's current token. The new pair is
+// issued first and the family only moves on if its current token is still the
+// presented one, so of two concurrent requests exactly one rotates. The other
+// gets errRotatedMeanwhile, with family updated to the winner's rotation.
+func (u *DB) rotateRefreshToken(ctx context.Context, claims *domain.JWTCustomClaims, family *refreshFamily, client domain.ClientInfo) (*domain.LoginResponse, error) {
+	familyKey := refreshFamilyPrefix + claims.FamilyID
+
+	user, err := u.currentRefreshTokenUser(ctx, claims)
+	if errors.Is(err, domain.ErrRefreshTokenInvalid) {
+		// The winner of a concurrent rotation deletes the token it replaced.
+		if getErr := u.cache.Get(ctx, familyKey, family); getErr == nil && claims.ID == family.Previous {
+			return nil, errRotatedMeanwhile
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, refreshTokenID, err := u.issueTokens(ctx, user, claims.FamilyID, family.Grant)
+	if err != nil {
+		return nil, err
+	}
+
+	// The grace tokens are keyed by the token they were issued as, so they are
+	// in place before any request can see the rotation.
+	graceKey := refreshFamilyGracePrefix + refreshTokenID
+	if u.config.RefreshTokenReuseGrace > 0 {
+		grace := refreshGrace{AccessToken: tokens.AccessToken, RefreshToken: tokens.RefreshToken}
+		if err := u.cache.Set(ctx, graceKey, grace, u.config.RefreshTokenReuseGrace); err != nil {
+			return nil, err
+		}
+	}
+
+	rotated := false
+	err = u.cache.Update(ctx, familyKey, family, u.config.RefreshTokenExpiredIn, func() (bool, error) {
+		if family.Current != claims.ID {
+			return false, nil
+		}
+		now := time.Now()
+		family.Previous = claims.ID
+		family.Current = refreshTokenID
+		family.RotatedAt = now
+		family.LastUsedAt = now
+		family.IP = client.IP
+		family.UserAgent = client.UserAgent
+		rotated = true
+		return true, nil
+	})
+	if err != nil || !rotated {
+		if discardErr := u.discardTokens(ctx, tokens.RefreshToken, graceKey); discardErr != nil {
+			return nil, discardErr
+		}
+		if err != nil {
+			return nil, orMissing(err, domain.ErrRefreshTokenInvalid)
+		}
+		return nil, errRotatedMeanwhile
+	}
+
+	if err := u.cache.Delete(ctx, claims.ID); err != nil {
+		return nil, err
+	}
+	if err := u.cache.RemoveFromSet(ctx, userTokensPrefix+user.ID.String(), claims.ID); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// discardTokens revokes a pair issued by a rotation that did not take place.
+func (u *DB) discardTokens(ctx context.Context, refreshToken, graceKey string) error {
+	claims, err := u.parseRefreshToken(refreshToken)
+	if err != nil {
+		return err
+	}
+	if err := u.revokeTokenPair(ctx, claims); err != nil {
+		return err
+	}
+	return u.cache.Delete(ctx, graceKey)
+}
+
+func (u *DB) graceTokens(ctx context.Context, userID string, grace *refreshGrace) (*domain.LoginResponse, error) {
+	user, err := u.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.LoginResponse{
+		CommonModel:  user.CommonModel,
+		Email:        user.Email,
+		Username:     user.Username,
+		AccessToken:  grace.AccessToken,
+		RefreshToken: grace.RefreshToken,
+	}, nil
+}
+
+func (u *DB) startRefreshFamily(ctx context.Context, familyID, userID, refreshTokenID string, client domain.ClientInfo, grant *oauthGrant) error {
+	now := time.Now()
+	family := refreshFamily{
+		UserID:      userID,
+		Current:     refreshTokenID,
+		RotatedAt:   now,
+		DeviceLabel: client.DeviceLabel,
+		IP:          client.IP,
+		UserAgent:   client.UserAgent,
+		CreatedAt:   now,
+		LastUsedAt:  now,
+		Grant:       grant,
+	}
+	if err := u.cache.Set(ctx, refreshFamilyPrefix+familyID, family, u.config.RefreshTokenExpiredIn); err != nil {
+		return err
+	}
+
+	return u.cache.AddToSet(ctx, userSessionsPrefix+userID, familyID, u.config.RefreshTokenExpiredIn)
+}
+
+// revokeRefreshFamily deletes every access and refresh token issued in the family.
+func (u *DB) revokeRefreshFamily(ctx context.Context, familyID, userID string) error {
+	family := &refreshFamily{}
+	if err := u.cache.Get(ctx, refreshFamilyPrefix+familyID, family); err == nil {
+		if err := u.cache.Delete(ctx, refreshFamilyGracePrefix+family.Current); err != nil {
+			return err
+		}
+	}
+
+	familyKey := refreshFamilyTokensPrefix + familyID
+	tokenIDs, err := u.cache.GetSetMembers(ctx, familyKey)
+	if err != nil {
+		return err
+	}
+
+	for _, tokenID := range tokenIDs {
+		if err := u.cache.Delete(ctx, tokenID); err != nil {
+			return err
+		}
+		if err := u.cache.RemoveFromSet(ctx, userTokensPrefix+userID, tokenID); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range []string{familyKey, refreshFamilyPrefix + familyID} {
+		if err := u.cache.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return u.cache.RemoveFromSet(ctx, userSessionsPrefix+userID, familyID)
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"go-chat/internals/core/domain"
+	"net/http"
+)
+
+// RevokeToken implements RFC 7009. Revoking either token of a pair revokes
+// both. Unknown, expired and already revoked tokens are not an error.
+func (o *DB) RevokeToken(ctx context.Context, req *domain.RevocationRequest) error {
+	client, err := o.authenticateOAuthClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return err
+	}
+
+	if req.Token == "" {
+		return &domain.OAuthError{Code: "invalid_request", Description: "token is required", Status: http.StatusBadRequest}
+	}
+
+	claims, tokenType, ok := o.parseAccessOrRefreshToken(req.Token, req.TokenTypeHint)
+	if !ok {
+		return nil
+	}
+
+	if owner := o.tokenClientID(ctx, claims, tokenType); owner != "" && owner != client.ClientID {
+		return &domain.OAuthError{Code: "unauthorized_client", Description: "token was not issued to this client", Status: http.StatusBadRequest}
+	}
+
+	return o.revokeTokenPair(ctx, claims)
+}
+
+// tokenClientID returns the client a token was issued to, or "" for tokens from a first-party login.
+func (o *DB) tokenClientID(ctx context.Context, claims *domain.JWTCustomClaims, tokenType string) string {
+	if claims.ClientID != "" {
+		return claims.ClientID
+	}
+
+	refreshTokenID := claims.ID
+	if tokenType == domain.TokenTypeAccessToken {
+		if err := o.cache.Get(ctx, tokenPairPrefix+claims.ID, &refreshTokenID); err != nil {
+			return ""
+		}
+	}
+
+	var grant oauthGrant
+	if err := o.cache.Get(ctx, oauthRefreshClientPrefix+refreshTokenID, &grant); err != nil {
+		return ""
+	}
+	return grant.ClientID
+}
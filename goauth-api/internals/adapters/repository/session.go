@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"go-chat/internals/core/domain"
+	"sort"
+)
+
+const userSessionsPrefix = "user_sessions:"
+
+func (s *DB) ListSessions(ctx context.Context, userID, currentSessionID string) ([]*domain.Session, error) {
+	familyIDs, err := s.cache.GetSetMembers(ctx, userSessionsPrefix+userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*domain.Session, 0, len(familyIDs))
+	for _, familyID := range familyIDs {
+		family := &refreshFamily{}
+		if err := s.cache.Get(ctx, refreshFamilyPrefix+familyID, family); err != nil {
+			// The family expired on its own, so drop it from the index.
+			if err := s.cache.RemoveFromSet(ctx, userSessionsPrefix+userID, familyID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		sessions = append(sessions, &domain.Session{
+			ID:          familyID,
+			DeviceLabel: family.DeviceLabel,
+			IP:          family.IP,
+			UserAgent:   family.UserAgent,
+			CreatedAt:   family.CreatedAt,
+			LastUsedAt:  family.LastUsedAt,
+			Current:     familyID == currentSessionID,
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+
+	return sessions, nil
+}
+
+func (s *DB) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	family := &refreshFamily{}
+	if err := s.cache.Get(ctx, refreshFamilyPrefix+sessionID, family); err != nil {
+		return orMissing(err, domain.ErrSessionNotFound)
+	}
+	if family.UserID != userID {
+		return domain.ErrSessionNotFound
+	}
+
+	return s.revokeRefreshFamily(ctx, sessionID, userID)
+}
+
+func (s *DB) RevokeOtherSessions(ctx context.Context, userID, currentSessionID string) error {
+	familyIDs, err := s.cache.GetSetMembers(ctx, userSessionsPrefix+userID)
+	if err != nil {
+		return err
+	}
+
+	for _, familyID := range familyIDs {
+		if familyID == currentSessionID {
+			continue
+		}
+		if err := s.revokeRefreshFamily(ctx, familyID, userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const operationCancelKey = "repository:cancel_operation"
+
+// UseOperationTimeout bounds every create, query, update, delete and raw
+// statement run through db by timeout, on top of any deadline of the context
+// passed with WithContext.
+func UseOperationTimeout(db *gorm.DB, timeout time.Duration) error {
+	if timeout <= 0 {
+		return nil
+	}
+
+	start := func(tx *gorm.DB) {
+		ctx, cancel := context.WithTimeout(tx.Statement.Context, timeout)
+		tx.Statement.Context = ctx
+		tx.InstanceSet(operationCancelKey, cancel)
+	}
+	finish := func(tx *gorm.DB) {
+		if cancel, ok := tx.InstanceGet(operationCancelKey); ok {
+			cancel.(context.CancelFunc)()
+		}
+	}
+
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("*").Register("timeout:start_create", start),
+		callbacks.Create().After("*").Register("timeout:finish_create", finish),
+		callbacks.Query().Before("*").Register("timeout:start_query", start),
+		callbacks.Query().After("*").Register("timeout:finish_query", finish),
+		callbacks.Update().Before("*").Register("timeout:start_update", start),
+		callbacks.Update().After("*").Register("timeout:finish_update", finish),
+		callbacks.Delete().Before("*").Register("timeout:start_delete", start),
+		callbacks.Delete().After("*").Register("timeout:finish_delete", finish),
+		callbacks.Raw().Before("*").Register("timeout:start_raw", start),
+		callbacks.Raw().After("*").Register("timeout:finish_raw", finish),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
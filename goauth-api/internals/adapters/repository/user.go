@@ -1,181 +1,255 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"go-chat/internals/config"
 	"go-chat/internals/core/domain"
+	"log"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
-func (u *DB) CreateUser(email, username, password string) (*domain.User, error) {
-	if err := u.checkExistingUser(email, username); err != nil {
+func (u *DB) CreateUser(ctx context.Context, email, username, password string) (*domain.User, error) {
+	// The policy and the hash do not depend on whether the account exists. Doing both
+	// first means a taken email or username is not answered any faster.
+	if err := u.policy.Check(password, email, username); err != nil {
 		return nil, err
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := u.hasher.Hash(password)
 	if err != nil {
-		return nil, fmt.Errorf("password not hashed: %v", err)
+		return nil, err
+	}
+
+	if err := u.checkExistingUser(ctx, email, username); err != nil {
+		return nil, err
 	}
 
 	user := &domain.User{
 		Email:    email,
 		Username: username,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
 	}
-	if err := u.db.Create(user).Error; err != nil {
+	if err := u.db.WithContext(ctx).Create(user).Error; err != nil {
 		return nil, fmt.Errorf("failed to create user: %v", err)
 	}
 
+	if err := u.AssignRole(ctx, user.ID.String(), domain.RoleUser); err != nil {
+		return nil, err
+	}
+
 	return user, nil
 }
 
-func (u *DB) LoginUser(email, password string) (*domain.LoginResponse, error) {
-	user, err := u.findUserByEmail(email)
+func (u *DB) LoginUser(ctx context.Context, email, password string, client domain.ClientInfo) (*domain.LoginResponse, error) {
+	user, err := u.findUserByEmail(ctx, email)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		// Take as long as a wrong password would, so the response time does not reveal whether the email is registered.
+		u.hasher.Verify(u.dummyPasswordHash(), password)
+		return nil, domain.ErrInvalidCredentials
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	if err := u.VerifyPassword(user.Password, password); err != nil {
-		return nil, err
+	if err := u.VerifyPassword(ctx, user, password); err != nil {
+		return nil, domain.ErrInvalidCredentials
 	}
 
-	return u.generateAndStoreTokens(user)
+	if u.config.RequireEmailVerification && user.VerifiedAt == nil {
+		return nil, domain.ErrEmailNotVerified
+	}
+
+	if user.TOTPEnabled {
+		return u.createMFAChallenge(ctx, user)
+	}
+
+	return u.generateAndStoreTokens(ctx, user, client)
 }
 
-func (u *DB) LogoutUser(refreshToken string) error {
+// LogoutUser ends the login the refresh token belongs to and returns the ID of its user.
+func (u *DB) LogoutUser(ctx context.Context, refreshToken string) (string, error) {
 	claims, err := u.parseRefreshToken(refreshToken)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	userID, err := u.GetUserTokenByID(claims.ID)
+	userID, err := u.GetUserTokenByID(ctx, claims.ID)
 	if err != nil {
-		return errors.New("invalid refresh token")
+		return "", orMissing(err, domain.ErrRefreshTokenInvalid)
 	}
 
-	if _, err := u.GetUserByID(userID); err != nil {
-		return errors.New("user not found")
+	if _, err := u.GetUserByID(ctx, userID); err != nil {
+		return "", err
 	}
 
 	if claims.ExpiresAt.Time.Before(time.Now()) {
-		return errors.New("refresh token expired")
+		return "", domain.ErrRefreshTokenExpired
 	}
 
-	if err := u.cache.Delete(claims.ID); err != nil {
-		return err
-	}
-
-	return nil
+	// The refresh token is the current one of its family, so this also ends the login.
+	return userID, u.revokeTokenPair(ctx, claims)
 }
 
-func (u *DB) RefreshTokens(refreshToken string) (*domain.LoginResponse, error) {
-	claims, user, err := u.validateRefreshToken(refreshToken)
-	if err != nil {
-		return nil, err
-	}
-
-	if err := u.cache.Delete(claims.ID); err != nil {
-		return nil, err
-	}
-
-	return u.generateAndStoreTokens(user)
-}
-
-func (u *DB) checkExistingUser(email, username string) error {
+func (u *DB) checkExistingUser(ctx context.Context, email, username string) error {
 	user := &domain.User{}
-	if err := u.db.First(user, "email = ?", email).Error; err == nil {
-		return errors.New("user with this email already exists")
+	if err := u.db.WithContext(ctx).First(user, "email = ?", email).Error; err == nil {
+		return domain.ErrEmailTaken
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
 	}
-	if err := u.db.First(user, "username = ?", username).Error; err == nil {
-		return errors.New("user with this username already exists")
+	if err := u.db.WithContext(ctx).First(user, "username = ?", username).Error; err == nil {
+		return domain.ErrUsernameTaken
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
 	}
 	return nil
 }
 
-func (u *DB) findUserByEmail(email string) (*domain.User, error) {
+func (u *DB) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return u.findUserByEmail(ctx, email)
+}
+
+// findUserByEmail never returns service accounts, which have no email and cannot log in.
+func (u *DB) findUserByEmail(ctx context.Context, email string) (*domain.User, error) {
 	user := &domain.User{}
-	if err := u.db.First(user, "email = ?", email).Error; err != nil {
-		return nil, errors.New("user not found")
+	if err := u.db.WithContext(ctx).First(user, "email = ? AND NOT service_account", email).Error; err != nil {
+		return nil, orMissing(err, domain.ErrUserNotFound)
 	}
 	return user, nil
 }
 
-func (u *DB) VerifyPassword(hash, password string) error {
-	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
-		return errors.New("password not matched")
+func (u *DB) storePassword(ctx context.Context, user *domain.User, password string) error {
+	hashedPassword, err := u.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	if err := u.db.WithContext(ctx).Model(user).Update("password", hashedPassword).Error; err != nil {
+		return fmt.Errorf("failed to update password: %v", err)
 	}
+
 	return nil
 }
 
-func (u *DB) parseRefreshToken(refreshToken string) (*domain.JWTCustomClaims, error) {
-	config, err := config.LoadConfig()
-	if err != nil {
-		return nil, err
+// VerifyPassword checks the user's password. A hash made with outdated
+// parameters or algorithm is replaced while the plain password is at hand.
+func (u *DB) VerifyPassword(ctx context.Context, user *domain.User, password string) error {
+	ok, needsRehash, err := u.hasher.Verify(user.Password, password)
+	if err != nil || !ok {
+		return domain.ErrInvalidCredentials
 	}
 
-	token, err := jwt.ParseWithClaims(refreshToken, &domain.JWTCustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	if needsRehash {
+		// The password is already in use, so the policy is not applied again.
+		if err := u.storePassword(ctx, user, password); err != nil {
+			log.Printf("failed to rehash password for user %s: %v", user.ID, err)
 		}
-		return []byte(config.JWTRefreshTokenSecret), nil
-	})
-	if err != nil {
-		return nil, errors.New("invalid refresh token")
 	}
 
-	claims, ok := token.Claims.(*domain.JWTCustomClaims)
-	if !ok || !token.Valid {
-		return nil, errors.New("invalid refresh token")
-	}
+	return nil
+}
 
-	return claims, nil
+// dummyPasswordHash returns the hash of a random password, made once with the
+// current hasher so that checking against it costs the same as a real login.
+func (u *DB) dummyPasswordHash() string {
+	u.dummyHashOnce.Do(func() {
+		password, err := randomToken()
+		if err != nil {
+			log.Printf("failed to create dummy password: %v", err)
+			return
+		}
+		hash, err := u.hasher.Hash(password)
+		if err != nil {
+			log.Printf("failed to create dummy password hash: %v", err)
+			return
+		}
+		u.dummyHash = hash
+	})
+	return u.dummyHash
 }
 
-func (u *DB) validateRefreshToken(refreshToken string) (*domain.JWTCustomClaims, *domain.User, error) {
-	claims, err := u.parseRefreshToken(refreshToken)
+func (u *DB) parseRefreshToken(refreshToken string) (*domain.JWTCustomClaims, error) {
+	claims, err := u.parseToken(refreshToken, domain.TokenUseRefresh)
+	if errors.Is(err, domain.ErrTokenExpired) {
+		return nil, domain.ErrRefreshTokenExpired
+	}
 	if err != nil {
-		return nil, nil, err
+		return nil, domain.ErrRefreshTokenInvalid
 	}
 
-	userID, err := u.GetUserTokenByID(claims.ID)
+	return claims, nil
+}
+
+// currentRefreshTokenUser checks that the refresh token has not been revoked or expired and returns its user.
+func (u *DB) currentRefreshTokenUser(ctx context.Context, claims *domain.JWTCustomClaims) (*domain.User, error) {
+	userID, err := u.GetUserTokenByID(ctx, claims.ID)
 	if err != nil {
-		return nil, nil, errors.New("invalid refresh token")
+		return nil, orMissing(err, domain.ErrRefreshTokenInvalid)
 	}
 
-	user, err := u.GetUserByID(userID)
+	user, err := u.GetUserByID(ctx, userID)
 	if err != nil {
-		return nil, nil, errors.New("user not found")
+		return nil, err
 	}
 
 	if claims.ExpiresAt.Time.Before(time.Now()) {
-		return nil, nil, errors.New("refresh token expired")
+		return nil, domain.ErrRefreshTokenExpired
 	}
 
-	return claims, user, nil
+	return user, nil
+}
+
+// generateAndStoreTokens starts a new login, and with it a new refresh token family.
+func (u *DB) generateAndStoreTokens(ctx context.Context, user *domain.User, client domain.ClientInfo) (*domain.LoginResponse, error) {
+	return u.startLogin(ctx, user, client, nil)
 }
 
-func (u *DB) generateAndStoreTokens(user *domain.User) (*domain.LoginResponse, error) {
-	config, err := config.LoadConfig()
+// startLogin starts a new refresh token family. A login the user gave an OAuth
+// client carries its grant, which limits every access token in the family.
+func (u *DB) startLogin(ctx context.Context, user *domain.User, client domain.ClientInfo, grant *oauthGrant) (*domain.LoginResponse, error) {
+	familyID := uuid.New().String()
+	tokens, refreshTokenID, err := u.issueTokens(ctx, user, familyID, grant)
 	if err != nil {
 		return nil, err
 	}
 
-	accessTokenDetails, err := u.generateToken(user, config.JWTAccessTokenSecret, config.AccessTokenExpiredIn)
-	if err != nil {
+	if err := u.startRefreshFamily(ctx, familyID, user.ID.String(), refreshTokenID, client, grant); err != nil {
 		return nil, err
 	}
 
-	refreshTokenDetails, err := u.generateToken(user, config.JWTRefreshTokenSecret, config.RefreshTokenExpiredIn)
+	return tokens, nil
+}
+
+// issueTokens creates an access and refresh token pair in the given family and returns the refresh token ID.
+func (u *DB) issueTokens(ctx context.Context, user *domain.User, familyID string, grant *oauthGrant) (*domain.LoginResponse, string, error) {
+	accessClaims := userClaims(user, domain.TokenUseAccess, familyID)
+	if grant != nil {
+		accessClaims.ClientID, accessClaims.Scope = grant.ClientID, grant.Scope
+	}
+	accessTokenDetails, err := u.signToken(accessClaims, u.config.AccessTokenExpiredIn)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	if err := u.storeTokensInCache(user.ID.String(), accessTokenDetails.TokenID, refreshTokenDetails.TokenID, time.Duration(accessTokenDetails.ExpiresIn), time.Duration(refreshTokenDetails.ExpiresIn)); err != nil {
-		return nil, err
+	refreshTokenDetails, err := u.generateToken(user, domain.TokenUseRefresh, familyID, u.config.RefreshTokenExpiredIn)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := u.storeTokensInCache(ctx, user.ID.String(), accessTokenDetails.TokenID, refreshTokenDetails.TokenID, time.Duration(accessTokenDetails.ExpiresIn), time.Duration(refreshTokenDetails.ExpiresIn)); err != nil {
+		return nil, "", err
+	}
+
+	familyKey := refreshFamilyTokensPrefix + familyID
+	if err := u.cache.AddToSet(ctx, familyKey, accessTokenDetails.TokenID, u.config.RefreshTokenExpiredIn); err != nil {
+		return nil, "", err
+	}
+	if err := u.cache.AddToSet(ctx, familyKey, refreshTokenDetails.TokenID, u.config.RefreshTokenExpiredIn); err != nil {
+		return nil, "", err
 	}
 
 	return &domain.LoginResponse{
@@ -184,5 +258,5 @@ func (u *DB) generateAndStoreTokens(user *domain.User) (*domain.LoginResponse, e
 		Username:     user.Username,
 		AccessToken:  accessTokenDetails.Token,
 		RefreshToken: refreshTokenDetails.Token,
-	}, nil
+	}, refreshTokenDetails.TokenID, nil
 }
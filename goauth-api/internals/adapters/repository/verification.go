@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"go-chat/internals/core/domain"
+	"time"
+)
+
+func (v *DB) CreateEmailVerificationToken(ctx context.Context, user *domain.User) (string, error) {
+	return v.createSingleUseToken(ctx, user, domain.TokenUseEmailVerification, v.config.VerificationTokenExpiredIn)
+}
+
+func (v *DB) VerifyEmail(ctx context.Context, token string) (*domain.User, error) {
+	userID, err := v.consumeSingleUseToken(ctx, token, domain.TokenUseEmailVerification)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := v.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.VerifiedAt != nil {
+		return user, nil
+	}
+
+	now := time.Now()
+	if err := v.db.WithContext(ctx).Model(user).Update("verified_at", now).Error; err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"go-chat/internals/adapters/webauthn"
+	"go-chat/internals/config"
+	"go-chat/internals/core/domain"
+	"time"
+)
+
+const webauthnChallengePrefix = "webauthn_challenge:"
+
+// webauthnSession is the pending ceremony stored under its challenge until it is finished or expires.
+type webauthnSession struct {
+	Ceremony string `json:"ceremony"`
+	UserID   string `json:"user_id,omitempty"`
+}
+
+func (w *DB) BeginPasskeyRegistration(ctx context.Context, userID string) (*domain.PublicKeyCredentialCreationOptions, error) {
+	user, err := w.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := w.credentialIDs(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := w.startWebAuthnCeremony(ctx, "webauthn.create", userID, w.config.WebAuthnChallengeExpiredIn)
+	if err != nil {
+		return nil, err
+	}
+
+	userEntity := domain.UserEntity{
+		ID:          user.ID[:],
+		Name:        user.Email,
+		DisplayName: user.Username,
+	}
+
+	return newRelyingParty(w.config).CreationOptions(challenge, userEntity, existing), nil
+}
+
+func (w *DB) FinishPasskeyRegistration(ctx context.Context, userID, name string, credential *domain.RegistrationCredential) (*domain.WebAuthnCredential, error) {
+	challenge, session, err := w.finishWebAuthnCeremony(ctx, credential.Response.ClientDataJSON, "webauthn.create")
+	if err != nil {
+		return nil, err
+	}
+
+	if session.UserID != userID {
+		return nil, domain.ErrChallengeInvalid
+	}
+
+	user, err := w.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	verified, err := newRelyingParty(w.config).VerifyRegistration(credential, challenge)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrPasskeyRejected, err)
+	}
+
+	if name == "" {
+		name = "Passkey"
+	}
+
+	record := &domain.WebAuthnCredential{
+		UserID:       user.ID,
+		CredentialID: verified.ID,
+		PublicKey:    verified.PublicKey,
+		SignCount:    verified.SignCount,
+		AAGUID:       verified.AAGUID,
+		Name:         name,
+	}
+	if err := w.db.WithContext(ctx).Create(record).Error; err != nil {
+		return nil, fmt.Errorf("failed to store passkey: %v", err)
+	}
+
+	return record, nil
+}
+
+// BeginPasskeyLogin never lists credentials: the authenticator offers a
+// discoverable credential instead, so the options cannot reveal which accounts
+// exist or have passkeys.
+func (w *DB) BeginPasskeyLogin(ctx context.Context) (*domain.PublicKeyCredentialRequestOptions, error) {
+	challenge, err := w.startWebAuthnCeremony(ctx, "webauthn.get", "", w.config.WebAuthnChallengeExpiredIn)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRelyingParty(w.config).RequestOptions(challenge, nil), nil
+}
+
+func (w *DB) FinishPasskeyLogin(ctx context.Context, credential *domain.AssertionCredential, client domain.ClientInfo) (*domain.LoginResponse, error) {
+	challenge, _, err := w.finishWebAuthnCeremony(ctx, credential.Response.ClientDataJSON, "webauthn.get")
+	if err != nil {
+		return nil, err
+	}
+
+	record := &domain.WebAuthnCredential{}
+	if err := w.db.WithContext(ctx).First(record, "credential_id = ?", []byte(credential.RawID)).Error; err != nil {
+		return nil, orMissing(err, domain.ErrPasskeyUnknown)
+	}
+	// A discoverable credential names its user, which must be the one it was registered to.
+	if handle := credential.Response.UserHandle; len(handle) > 0 && string(handle) != string(record.UserID[:]) {
+		return nil, domain.ErrPasskeyUnknown
+	}
+
+	signCount, err := newRelyingParty(w.config).VerifyAssertion(credential, challenge, record.PublicKey, record.SignCount)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrPasskeyRejected, err)
+	}
+
+	user, err := w.GetUserByID(ctx, record.UserID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.db.WithContext(ctx).Model(record).Updates(map[string]interface{}{
+		"sign_count":   signCount,
+		"last_used_at": time.Now(),
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update passkey: %v", err)
+	}
+
+	return w.generateAndStoreTokens(ctx, user, client)
+}
+
+func (w *DB) startWebAuthnCeremony(ctx context.Context, ceremony, userID string, expiration time.Duration) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	session := webauthnSession{Ceremony: ceremony, UserID: userID}
+	key := webauthnChallengePrefix + base64.RawURLEncoding.EncodeToString(challenge)
+	if err := w.cache.Set(ctx, key, session, expiration); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// finishWebAuthnCeremony consumes the pending ceremony for the challenge in
+// clientDataJSON, so each challenge can be answered only once.
+func (w *DB) finishWebAuthnCeremony(ctx context.Context, clientDataJSON []byte, ceremony string) ([]byte, *webauthnSession, error) {
+	challenge, err := webauthn.ChallengeFromClientData(clientDataJSON)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", domain.ErrPasskeyRejected, err)
+	}
+
+	key := webauthnChallengePrefix + base64.RawURLEncoding.EncodeToString(challenge)
+	session := &webauthnSession{}
+	if err := w.cache.Take(ctx, key, session); err != nil {
+		return nil, nil, orMissing(err, domain.ErrChallengeInvalid)
+	}
+
+	if session.Ceremony != ceremony {
+		return nil, nil, domain.ErrChallengeInvalid
+	}
+
+	return challenge, session, nil
+}
+
+func (w *DB) credentialIDs(ctx context.Context, user *domain.User) ([][]byte, error) {
+	var credentials []*domain.WebAuthnCredential
+	if err := w.db.WithContext(ctx).Where("user_id = ?", user.ID).Find(&credentials).Error; err != nil {
+		return nil, err
+	}
+
+	ids := make([][]byte, 0, len(credentials))
+	for _, credential := range credentials {
+		ids = append(ids, credential.CredentialID)
+	}
+	return ids, nil
+}
+
+func newRelyingParty(config config.Config) *webauthn.RelyingParty {
+	return webauthn.NewRelyingParty(config.WebAuthnRPID, config.WebAuthnRPName, config.WebAuthnOrigins, config.WebAuthnChallengeExpiredIn)
+}
@@ -0,0 +1,199 @@
+package signing
+
+import (
+	"errors"
+	"fmt"
+	"go-chat/internals/core/domain"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type ringKey struct {
+	key *Key
+	// retiredAt is when a newer key became active. Retired keys are only used for verification.
+	retiredAt time.Time
+}
+
+// KeyRing signs with a single active key and keeps previously active keys
+// published for verification until their grace period has passed.
+//
+// When the ring is backed by a directory, every *.pem file in it is a key and
+// the most recently modified one is active. Rotating writes a new file, so
+// the ring survives restarts and can be shared by several instances.
+type KeyRing struct {
+	mu          sync.RWMutex
+	dir         string
+	algorithm   string
+	gracePeriod time.Duration
+	keys        []ringKey
+}
+
+// LoadKeyRing reads the keys in dir, generating and saving a first key with
+// the given algorithm when the directory is empty.
+func LoadKeyRing(dir, algorithm string, gracePeriod time.Duration) (*KeyRing, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create signing key directory: %v", err)
+	}
+
+	ring := &KeyRing{dir: dir, algorithm: algorithm, gracePeriod: gracePeriod}
+	if err := ring.Reload(); err != nil {
+		return nil, err
+	}
+
+	if len(ring.keys) == 0 {
+		if _, err := ring.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return ring, nil
+}
+
+// Reload re-reads the key directory, picking up keys rotated by another instance or placed there by an operator.
+func (r *KeyRing) Reload() error {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read signing key directory: %v", err)
+	}
+
+	type keyFile struct {
+		key     *Key
+		modTime time.Time
+	}
+	var files []keyFile
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".pem") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		key, err := LoadKey(filepath.Join(r.dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("%s: %v", entry.Name(), err)
+		}
+
+		files = append(files, keyFile{key: key, modTime: info.ModTime()})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	keys := make([]ringKey, 0, len(files))
+	for i, file := range files {
+		rk := ringKey{key: file.key}
+		if i < len(files)-1 {
+			rk.retiredAt = files[i+1].modTime
+		}
+		keys = append(keys, rk)
+	}
+
+	r.mu.Lock()
+	r.keys = keys
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Rotate generates a new key, saves it and makes it the active signing key.
+func (r *KeyRing) Rotate() (*Key, error) {
+	key, err := GenerateKey(r.algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := key.MarshalPEM()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%d-%s.pem", now.Unix(), key.ID)
+	if err := os.WriteFile(filepath.Join(r.dir, name), data, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to save signing key: %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.keys) > 0 {
+		r.keys[len(r.keys)-1].retiredAt = now
+	}
+	r.keys = append(r.keys, ringKey{key: key})
+
+	return key, nil
+}
+
+func (r *KeyRing) Active() *Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.keys[len(r.keys)-1].key
+}
+
+// Lookup returns the key with the given ID if it is active or still within its grace period.
+func (r *KeyRing) Lookup(kid string) (*Key, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, rk := range r.keys {
+		if rk.key.ID == kid && r.published(rk) {
+			return rk.key, true
+		}
+	}
+	return nil, false
+}
+
+// Keyfunc selects the verification key by the token's kid header and
+// rejects tokens whose algorithm does not match that key.
+func (r *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := r.Lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	if token.Method.Alg() != key.Algorithm() {
+		return nil, errors.New("unexpected signing method: " + token.Method.Alg())
+	}
+
+	return key.PublicKey(), nil
+}
+
+func (r *KeyRing) JWKS() domain.JSONWebKeySet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keySet := domain.JSONWebKeySet{Keys: []domain.JSONWebKey{}}
+	for _, rk := range r.keys {
+		if r.published(rk) {
+			keySet.Keys = append(keySet.Keys, rk.key.JWK())
+		}
+	}
+	return keySet
+}
+
+// Algorithms lists the algorithms of the published keys.
+func (r *KeyRing) Algorithms() []string {
+	seen := map[string]bool{}
+	var algorithms []string
+	for _, jwk := range r.JWKS().Keys {
+		if !seen[jwk.Algorithm] {
+			seen[jwk.Algorithm] = true
+			algorithms = append(algorithms, jwk.Algorithm)
+		}
+	}
+	return algorithms
+}
+
+func (r *KeyRing) published(rk ringKey) bool {
+	return rk.retiredAt.IsZero() || time.Since(rk.retiredAt) < r.gracePeriod
+}
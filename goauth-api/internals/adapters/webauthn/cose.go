@@ -0,0 +1,131 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// COSE algorithm identifiers, see https://www.iana.org/assignments/cose.
+const (
+	algES256 = -7
+	algEdDSA = -8
+	algRS256 = -257
+)
+
+const (
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+type publicKey struct {
+	alg int
+	key crypto.PublicKey
+}
+
+func parsePublicKey(data []byte) (*publicKey, error) {
+	var params map[int]cbor.RawMessage
+	if err := cbor.Unmarshal(data, &params); err != nil {
+		return nil, fmt.Errorf("invalid credential public key: %v", err)
+	}
+
+	var kty, alg int
+	if err := decodeParam(params, 1, &kty); err != nil {
+		return nil, err
+	}
+	if err := decodeParam(params, 3, &alg); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case kty == coseKeyTypeEC2 && alg == algES256:
+		var crv int
+		var x, y []byte
+		if err := decodeParam(params, -1, &crv); err != nil {
+			return nil, err
+		}
+		if err := decodeParam(params, -2, &x); err != nil {
+			return nil, err
+		}
+		if err := decodeParam(params, -3, &y); err != nil {
+			return nil, err
+		}
+		if crv != coseCurveP256 {
+			return nil, errors.New("unsupported elliptic curve")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("invalid elliptic curve point")
+		}
+		return &publicKey{alg: alg, key: key}, nil
+
+	case kty == coseKeyTypeOKP && alg == algEdDSA:
+		var crv int
+		var x []byte
+		if err := decodeParam(params, -1, &crv); err != nil {
+			return nil, err
+		}
+		if err := decodeParam(params, -2, &x); err != nil {
+			return nil, err
+		}
+		if crv != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("unsupported okp key")
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case kty == coseKeyTypeRSA && alg == algRS256:
+		var n, e []byte
+		if err := decodeParam(params, -1, &n); err != nil {
+			return nil, err
+		}
+		if err := decodeParam(params, -2, &e); err != nil {
+			return nil, err
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return &publicKey{alg: alg, key: key}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported credential key type %d with algorithm %d", kty, alg)
+}
+
+func (k *publicKey) verify(message, signature []byte) error {
+	var ok bool
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		ok = ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, message, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(message)
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+
+	if !ok {
+		return errors.New("invalid assertion signature")
+	}
+	return nil
+}
+
+func decodeParam(params map[int]cbor.RawMessage, label int, value interface{}) error {
+	raw, ok := params[label]
+	if !ok {
+		return fmt.Errorf("credential public key is missing parameter %d", label)
+	}
+	if err := cbor.Unmarshal(raw, value); err != nil {
+		return fmt.Errorf("invalid credential public key parameter %d: %v", label, err)
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+// Package webauthn implements the relying party side of the WebAuthn
+// registration and assertion ceremonies. Attestation statements are not
+// verified: credentials are trusted on first use, the same as with the
+// "none" attestation conveyance that the creation options request.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-chat/internals/core/domain"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	flagUserPresent            = 0x01
+	flagAttestedCredentialData = 0x40
+
+	challengeSize = 32
+)
+
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+	Timeout time.Duration
+}
+
+func NewRelyingParty(id, name string, origins []string, timeout time.Duration) *RelyingParty {
+	return &RelyingParty{
+		ID:      id,
+		Name:    name,
+		Origins: origins,
+		Timeout: timeout,
+	}
+}
+
+// Credential is the result of a successful registration ceremony.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+	AAGUID    []byte
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type attestationObject struct {
+	Fmt      string          `cbor:"fmt"`
+	AttStmt  cbor.RawMessage `cbor:"attStmt"`
+	AuthData []byte          `cbor:"authData"`
+}
+
+type authenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// ChallengeFromClientData extracts the challenge the client signed so the
+// pending ceremony can be looked up before the response is verified.
+func ChallengeFromClientData(clientDataJSON []byte) ([]byte, error) {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return nil, errors.New("invalid client data")
+	}
+	return base64.RawURLEncoding.DecodeString(data.Challenge)
+}
+
+func (rp *RelyingParty) CreationOptions(challenge []byte, user domain.UserEntity, exclude [][]byte) *domain.PublicKeyCredentialCreationOptions {
+	return &domain.PublicKeyCredentialCreationOptions{
+		Challenge:    challenge,
+		RelyingParty: domain.RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:         user,
+		PubKeyCredParams: []domain.CredentialParameter{
+			{Type: "public-key", Alg: algES256},
+			{Type: "public-key", Alg: algEdDSA},
+			{Type: "public-key", Alg: algRS256},
+		},
+		Timeout:            rp.Timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: domain.AuthenticatorSelection{
+			// Passkey login offers no credential list, so credentials must be discoverable.
+			ResidentKey:      "required",
+			UserVerification: "preferred",
+		},
+		Attestation: "none",
+	}
+}
+
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow [][]byte) *domain.PublicKeyCredentialRequestOptions {
+	return &domain.PublicKeyCredentialRequestOptions{
+		Challenge:        challenge,
+		Timeout:          rp.Timeout.Milliseconds(),
+		RelyingPartyID:   rp.ID,
+		AllowCredentials: descriptors(allow),
+		UserVerification: "preferred",
+	}
+}
+
+func (rp *RelyingParty) VerifyRegistration(credential *domain.RegistrationCredential, challenge []byte) (*Credential, error) {
+	if credential.Type != "public-key" {
+		return nil, errors.New("unsupported credential type")
+	}
+
+	if err := rp.verifyClientData(credential.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	var attestation attestationObject
+	if err := cbor.Unmarshal(credential.Response.AttestationObject, &attestation); err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %v", err)
+	}
+
+	authData, err := parseAuthenticatorData(attestation.AuthData)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+
+	if authData.Flags&flagAttestedCredentialData == 0 {
+		return nil, errors.New("attested credential data missing")
+	}
+
+	if !bytes.Equal(authData.CredentialID, credential.RawID) {
+		return nil, errors.New("credential id mismatch")
+	}
+
+	if _, err := parsePublicKey(authData.PublicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        authData.CredentialID,
+		PublicKey: authData.PublicKey,
+		SignCount: authData.SignCount,
+		AAGUID:    authData.AAGUID,
+	}, nil
+}
+
+// VerifyAssertion checks an assertion against the stored public key and
+// returns the new signature counter.
+func (rp *RelyingParty) VerifyAssertion(credential *domain.AssertionCredential, challenge, publicKey []byte, storedSignCount uint32) (uint32, error) {
+	if credential.Type != "public-key" {
+		return 0, errors.New("unsupported credential type")
+	}
+
+	if err := rp.verifyClientData(credential.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := parseAuthenticatorData(credential.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(credential.Response.ClientDataJSON)
+	signed := append(append([]byte{}, credential.Response.AuthenticatorData...), clientDataHash[:]...)
+	if err := key.verify(signed, credential.Response.Signature); err != nil {
+		return 0, err
+	}
+
+	// A counter that does not increase indicates a cloned authenticator.
+	// Authenticators that do not implement counters always report zero.
+	if authData.SignCount != 0 || storedSignCount != 0 {
+		if authData.SignCount <= storedSignCount {
+			return 0, errors.New("signature counter did not increase")
+		}
+	}
+
+	return authData.SignCount, nil
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return errors.New("invalid client data")
+	}
+
+	if data.Type != ceremony {
+		return fmt.Errorf("unexpected client data type %q", data.Type)
+	}
+
+	received, err := base64.RawURLEncoding.DecodeString(data.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return errors.New("challenge mismatch")
+	}
+
+	for _, origin := range rp.Origins {
+		if data.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected origin %q", data.Origin)
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(authData *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.RPIDHash, rpIDHash[:]) {
+		return errors.New("relying party id mismatch")
+	}
+
+	if authData.Flags&flagUserPresent == 0 {
+		return errors.New("user presence flag not set")
+	}
+
+	return nil
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("authenticator data too short")
+	}
+
+	authData := &authenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	if authData.Flags&flagAttestedCredentialData == 0 {
+		return authData, nil
+	}
+
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, errors.New("attested credential data too short")
+	}
+	authData.AAGUID = rest[:16]
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLength {
+		return nil, errors.New("credential id too short")
+	}
+	authData.CredentialID = rest[:idLength]
+	rest = rest[idLength:]
+
+	// The public key is followed by optional extension data, so only the first CBOR item is taken.
+	var key cbor.RawMessage
+	if _, err := cbor.UnmarshalFirst(rest, &key); err != nil {
+		return nil, fmt.Errorf("invalid credential public key: %v", err)
+	}
+	authData.PublicKey = key
+
+	return authData, nil
+}
+
+func descriptors(ids [][]byte) []domain.CredentialDescriptor {
+	result := make([]domain.CredentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, domain.CredentialDescriptor{Type: "public-key", ID: id})
+	}
+	return result
+}
@@ -0,0 +1,179 @@
+// Package webauthntest provides a software authenticator that answers
+// WebAuthn ceremonies the way a browser and platform authenticator would,
+// so the passkey endpoints can be exercised from Go tests.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"go-chat/internals/core/domain"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagAttestedCredentialData = 0x40
+)
+
+type credential struct {
+	id         []byte
+	privateKey *ecdsa.PrivateKey
+	userHandle []byte
+	signCount  uint32
+}
+
+// Authenticator holds ES256 credentials in memory and increments its
+// signature counter on every assertion.
+type Authenticator struct {
+	RPID        string
+	Origin      string
+	credentials []*credential
+}
+
+func NewAuthenticator(rpID, origin string) *Authenticator {
+	return &Authenticator{
+		RPID:   rpID,
+		Origin: origin,
+	}
+}
+
+// Clone returns a copy of the authenticator with the same keys and counters,
+// as an attacker who extracted its keys would hold. From then on the two count
+// signatures separately.
+func (a *Authenticator) Clone() *Authenticator {
+	clone := &Authenticator{RPID: a.RPID, Origin: a.Origin}
+	for _, cred := range a.credentials {
+		copied := *cred
+		clone.credentials = append(clone.credentials, &copied)
+	}
+	return clone
+}
+
+func (a *Authenticator) Register(options *domain.PublicKeyCredentialCreationOptions) (*domain.RegistrationCredential, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	cred := &credential{id: id, privateKey: privateKey, userHandle: options.User.ID}
+	a.credentials = append(a.credentials, cred)
+
+	publicKey, err := cbor.Marshal(map[int]interface{}{
+		1:  2,
+		3:  -7,
+		-1: 1,
+		-2: privateKey.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: privateKey.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	authData := a.authenticatorData(flagUserPresent|flagUserVerified|flagAttestedCredentialData, 0)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(id)))
+	authData = append(authData, id...)
+	authData = append(authData, publicKey...)
+
+	attestationObject, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataJSON, err := a.clientData("webauthn.create", options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.RegistrationCredential{
+		ID:    base64.RawURLEncoding.EncodeToString(id),
+		RawID: id,
+		Type:  "public-key",
+		Response: domain.AttestationResponse{
+			ClientDataJSON:    clientDataJSON,
+			AttestationObject: attestationObject,
+		},
+	}, nil
+}
+
+// Login answers with the first credential that is allowed by the options,
+// or the first credential held when the list is empty (discoverable login).
+func (a *Authenticator) Login(options *domain.PublicKeyCredentialRequestOptions) (*domain.AssertionCredential, error) {
+	cred := a.find(options.AllowCredentials)
+	if cred == nil {
+		return nil, errors.New("no matching credential")
+	}
+
+	cred.signCount++
+	authData := a.authenticatorData(flagUserPresent|flagUserVerified, cred.signCount)
+
+	clientDataJSON, err := a.clientData("webauthn.get", options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, cred.privateKey, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.AssertionCredential{
+		ID:    base64.RawURLEncoding.EncodeToString(cred.id),
+		RawID: cred.id,
+		Type:  "public-key",
+		Response: domain.AssertionResponse{
+			ClientDataJSON:    clientDataJSON,
+			AuthenticatorData: authData,
+			Signature:         signature,
+			UserHandle:        cred.userHandle,
+		},
+	}, nil
+}
+
+func (a *Authenticator) find(allowed []domain.CredentialDescriptor) *credential {
+	for _, cred := range a.credentials {
+		if len(allowed) == 0 {
+			return cred
+		}
+		for _, descriptor := range allowed {
+			if string(descriptor.ID) == string(cred.id) {
+				return cred
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) authenticatorData(flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge []byte) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type":      ceremony,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    a.Origin,
+	})
+}
@@ -1,51 +1,303 @@
 package config
 
 import (
-	"os"
+	"flag"
 	"time"
-
-	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	DBHost                string        `envconfig:"DB_HOST"`
-	DBUser                string        `envconfig:"DB_USER"`
-	DBPassword            string        `envconfig:"DB_PASSWORD"`
-	DBName                string        `envconfig:"DB_NAME"`
-	DBPort                string        `envconfig:"DB_PORT"`
-	JWTAccessTokenSecret  string        `envconfig:"JWT_ACCESS_TOKEN"`
-	AccessTokenExpiredIn  time.Duration `envconfig:"ACCESS_TOKEN_EXPIRED_IN"`
-	JWTRefreshTokenSecret string        `envconfig:"JWT_REFRESH_TOKEN"`
-	RefreshTokenExpiredIn time.Duration `envconfig:"REFRESH_TOKEN_EXPIRED_IN"`
+	Port                        string        `envconfig:"PORT"`
+	DBHost                      string        `envconfig:"DB_HOST"`
+	DBUser                      string        `envconfig:"DB_USER"`
+	DBPassword                  string        `envconfig:"DB_PASSWORD"`
+	DBName                      string        `envconfig:"DB_NAME"`
+	DBPort                      string        `envconfig:"DB_PORT"`
+	DatabaseDriver              string        `envconfig:"DATABASE_DRIVER"`
+	SQLiteDSN                   string        `envconfig:"SQLITE_DSN"`
+	CacheDriver                 string        `envconfig:"CACHE_DRIVER"`
+	RedisAddr                   string        `envconfig:"REDIS_ADDR"`
+	RedisPassword               string        `envconfig:"REDIS_PASSWORD"`
+	RequestTimeout              time.Duration `envconfig:"REQUEST_TIMEOUT"`
+	DBTimeout                   time.Duration `envconfig:"DB_TIMEOUT"`
+	RedisTimeout                time.Duration `envconfig:"REDIS_TIMEOUT"`
+	AccessTokenExpiredIn        time.Duration `envconfig:"ACCESS_TOKEN_EXPIRED_IN"`
+	RefreshTokenExpiredIn       time.Duration `envconfig:"REFRESH_TOKEN_EXPIRED_IN"`
+	RefreshTokenReuseGrace      time.Duration `envconfig:"REFRESH_TOKEN_REUSE_GRACE"`
+	VerificationTokenExpiredIn  time.Duration `envconfig:"VERIFICATION_TOKEN_EXPIRED_IN"`
+	RequireEmailVerification    bool          `envconfig:"REQUIRE_EMAIL_VERIFICATION"`
+	EnumerationSafeRegistration bool          `envconfig:"ENUMERATION_SAFE_REGISTRATION"`
+	PasswordResetTokenExpiredIn time.Duration `envconfig:"PASSWORD_RESET_TOKEN_EXPIRED_IN"`
+	MFATokenExpiredIn           time.Duration `envconfig:"MFA_TOKEN_EXPIRED_IN"`
+	MFAEncryptionKey            string        `envconfig:"MFA_ENCRYPTION_KEY"`
+	MFAIssuer                   string        `envconfig:"MFA_ISSUER"`
+	WebAuthnRPID                string        `envconfig:"WEBAUTHN_RP_ID"`
+	WebAuthnRPName              string        `envconfig:"WEBAUTHN_RP_NAME"`
+	WebAuthnOrigins             []string      `envconfig:"WEBAUTHN_ORIGINS"`
+	WebAuthnChallengeExpiredIn  time.Duration `envconfig:"WEBAUTHN_CHALLENGE_EXPIRED_IN"`
+	OAuthCodeExpiredIn          time.Duration `envconfig:"OAUTH_CODE_EXPIRED_IN"`
+	OIDCIssuer                  string        `envconfig:"OIDC_ISSUER"`
+	IDTokenExpiredIn            time.Duration `envconfig:"ID_TOKEN_EXPIRED_IN"`
+	APIKeyExpiredIn             time.Duration `envconfig:"API_KEY_EXPIRED_IN"`
+	LoginFailureWindow          time.Duration `envconfig:"LOGIN_FAILURE_WINDOW"`
+	LoginBackoffAfter           int           `envconfig:"LOGIN_BACKOFF_AFTER"`
+	LoginBackoffBase            time.Duration `envconfig:"LOGIN_BACKOFF_BASE"`
+	LoginBackoffMax             time.Duration `envconfig:"LOGIN_BACKOFF_MAX"`
+	LoginLockoutThreshold       int           `envconfig:"LOGIN_LOCKOUT_THRESHOLD"`
+	LoginLockoutDuration        time.Duration `envconfig:"LOGIN_LOCKOUT_DURATION"`
+	LoginIPFailureLimit         int           `envconfig:"LOGIN_IP_FAILURE_LIMIT"`
+	SigningKeyDir               string        `envconfig:"SIGNING_KEY_DIR"`
+	SigningKeyAlgorithm         string        `envconfig:"SIGNING_KEY_ALGORITHM"`
+	SigningKeyGracePeriod       time.Duration `envconfig:"SIGNING_KEY_GRACE_PERIOD"`
+	PasswordHashAlgorithm       string        `envconfig:"PASSWORD_HASH_ALGORITHM"`
+	Argon2Memory                int           `envconfig:"ARGON2_MEMORY"`
+	Argon2Time                  int           `envconfig:"ARGON2_TIME"`
+	Argon2Parallelism           int           `envconfig:"ARGON2_PARALLELISM"`
+	BcryptCost                  int           `envconfig:"BCRYPT_COST"`
+	PasswordMinLength           int           `envconfig:"PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength           int           `envconfig:"PASSWORD_MAX_LENGTH"`
+	PasswordMinCharacterClasses int           `envconfig:"PASSWORD_MIN_CHARACTER_CLASSES"`
+	PasswordBreachedListFile    string        `envconfig:"PASSWORD_BREACHED_LIST_FILE"`
+	AuditSinks                  []string      `envconfig:"AUDIT_SINKS"`
+	AuditLogFile                string        `envconfig:"AUDIT_LOG_FILE"`
+	MailDriver                  string        `envconfig:"MAIL_DRIVER"`
+	SMTPHost                    string        `envconfig:"SMTP_HOST"`
+	SMTPPort                    string        `envconfig:"SMTP_PORT"`
+	SMTPUsername                string        `envconfig:"SMTP_USERNAME"`
+	SMTPPassword                string        `envconfig:"SMTP_PASSWORD"`
+	MailFrom                    string        `envconfig:"MAIL_FROM"`
 }
 
-func LoadConfig() (Config, error) {
-	err := godotenv.Load()
+// Load reads the configuration once at startup. Each setting is taken from the
+// environment (including a .env file in the working directory, if there is
+// one), then from the YAML or JSON file at path, then from flags set on the
+// command line, falling back to its default. The result is validated.
+func Load(path string, flags *flag.FlagSet) (Config, error) {
+	s, err := newSource(path, flags)
 	if err != nil {
 		return Config{}, err
 	}
 
 	config := Config{
-		DBHost:                os.Getenv("DB_HOST"),
-		DBUser:                os.Getenv("DB_USER"),
-		DBPassword:            os.Getenv("DB_PASSWORD"),
-		DBName:                os.Getenv("DB_NAME"),
-		DBPort:                os.Getenv("DB_PORT"),
-		JWTAccessTokenSecret:  os.Getenv("JWT_ACCESS_TOKEN"),
-		JWTRefreshTokenSecret: os.Getenv("JWT_REFRESH_TOKEN"),
+		Port:                     s.string("PORT", "8080"),
+		DBHost:                   s.string("DB_HOST", ""),
+		DBUser:                   s.string("DB_USER", ""),
+		DBPassword:               s.string("DB_PASSWORD", ""),
+		DBName:                   s.string("DB_NAME", ""),
+		DBPort:                   s.string("DB_PORT", "5432"),
+		DatabaseDriver:           s.string("DATABASE_DRIVER", "postgres"),
+		SQLiteDSN:                s.string("SQLITE_DSN", "file::memory:?cache=shared"),
+		CacheDriver:              s.string("CACHE_DRIVER", "redis"),
+		RedisAddr:                s.string("REDIS_ADDR", "127.0.0.1:6379"),
+		RedisPassword:            s.string("REDIS_PASSWORD", ""),
+		MFAEncryptionKey:         s.string("MFA_ENCRYPTION_KEY", ""),
+		MFAIssuer:                s.string("MFA_ISSUER", "GoAuth"),
+		WebAuthnRPID:             s.string("WEBAUTHN_RP_ID", "localhost"),
+		WebAuthnRPName:           s.string("WEBAUTHN_RP_NAME", "GoAuth"),
+		WebAuthnOrigins:          s.list("WEBAUTHN_ORIGINS", "http://localhost:8080"),
+		OIDCIssuer:               s.string("OIDC_ISSUER", "http://localhost:8080"),
+		SigningKeyDir:            s.string("SIGNING_KEY_DIR", "keys"),
+		SigningKeyAlgorithm:      s.string("SIGNING_KEY_ALGORITHM", "RS256"),
+		PasswordHashAlgorithm:    s.string("PASSWORD_HASH_ALGORITHM", "argon2id"),
+		PasswordBreachedListFile: s.string("PASSWORD_BREACHED_LIST_FILE", ""),
+		AuditSinks:               s.list("AUDIT_SINKS", "postgres"),
+		AuditLogFile:             s.string("AUDIT_LOG_FILE", "audit.jsonl"),
+		MailDriver:               s.string("MAIL_DRIVER", "smtp"),
+		SMTPHost:                 s.string("SMTP_HOST", ""),
+		SMTPPort:                 s.string("SMTP_PORT", ""),
+		SMTPUsername:             s.string("SMTP_USERNAME", ""),
+		SMTPPassword:             s.string("SMTP_PASSWORD", ""),
+		MailFrom:                 s.string("MAIL_FROM", ""),
 	}
 
-	accessTokenExpiredIn, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_EXPIRED_IN"))
+	accessTokenExpiredIn, err := s.duration("ACCESS_TOKEN_EXPIRED_IN", 30*time.Minute)
 	if err != nil {
 		return Config{}, err
 	}
 	config.AccessTokenExpiredIn = accessTokenExpiredIn
 
-	refreshTokenExpiredIn, err := time.ParseDuration(os.Getenv("REFRESH_TOKEN_EXPIRED_IN"))
+	refreshTokenExpiredIn, err := s.duration("REFRESH_TOKEN_EXPIRED_IN", time.Hour)
 	if err != nil {
 		return Config{}, err
 	}
 	config.RefreshTokenExpiredIn = refreshTokenExpiredIn
 
+	refreshTokenReuseGrace, err := s.duration("REFRESH_TOKEN_REUSE_GRACE", 10*time.Second)
+	if err != nil {
+		return Config{}, err
+	}
+	config.RefreshTokenReuseGrace = refreshTokenReuseGrace
+
+	verificationTokenExpiredIn, err := s.duration("VERIFICATION_TOKEN_EXPIRED_IN", 24*time.Hour)
+	if err != nil {
+		return Config{}, err
+	}
+	config.VerificationTokenExpiredIn = verificationTokenExpiredIn
+
+	passwordResetTokenExpiredIn, err := s.duration("PASSWORD_RESET_TOKEN_EXPIRED_IN", 15*time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+	config.PasswordResetTokenExpiredIn = passwordResetTokenExpiredIn
+
+	mfaTokenExpiredIn, err := s.duration("MFA_TOKEN_EXPIRED_IN", 5*time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+	config.MFATokenExpiredIn = mfaTokenExpiredIn
+
+	webAuthnChallengeExpiredIn, err := s.duration("WEBAUTHN_CHALLENGE_EXPIRED_IN", 5*time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+	config.WebAuthnChallengeExpiredIn = webAuthnChallengeExpiredIn
+
+	oauthCodeExpiredIn, err := s.duration("OAUTH_CODE_EXPIRED_IN", time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+	config.OAuthCodeExpiredIn = oauthCodeExpiredIn
+
+	idTokenExpiredIn, err := s.duration("ID_TOKEN_EXPIRED_IN", time.Hour)
+	if err != nil {
+		return Config{}, err
+	}
+	config.IDTokenExpiredIn = idTokenExpiredIn
+
+	apiKeyExpiredIn, err := s.duration("API_KEY_EXPIRED_IN", 90*24*time.Hour)
+	if err != nil {
+		return Config{}, err
+	}
+	config.APIKeyExpiredIn = apiKeyExpiredIn
+
+	loginFailureWindow, err := s.duration("LOGIN_FAILURE_WINDOW", 15*time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+	config.LoginFailureWindow = loginFailureWindow
+
+	loginBackoffAfter, err := s.int("LOGIN_BACKOFF_AFTER", 3)
+	if err != nil {
+		return Config{}, err
+	}
+	config.LoginBackoffAfter = loginBackoffAfter
+
+	loginBackoffBase, err := s.duration("LOGIN_BACKOFF_BASE", time.Second)
+	if err != nil {
+		return Config{}, err
+	}
+	config.LoginBackoffBase = loginBackoffBase
+
+	loginBackoffMax, err := s.duration("LOGIN_BACKOFF_MAX", time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+	config.LoginBackoffMax = loginBackoffMax
+
+	loginLockoutThreshold, err := s.int("LOGIN_LOCKOUT_THRESHOLD", 10)
+	if err != nil {
+		return Config{}, err
+	}
+	config.LoginLockoutThreshold = loginLockoutThreshold
+
+	loginLockoutDuration, err := s.duration("LOGIN_LOCKOUT_DURATION", 15*time.Minute)
+	if err != nil {
+		return Config{}, err
+	}
+	config.LoginLockoutDuration = loginLockoutDuration
+
+	loginIPFailureLimit, err := s.int("LOGIN_IP_FAILURE_LIMIT", 50)
+	if err != nil {
+		return Config{}, err
+	}
+	config.LoginIPFailureLimit = loginIPFailureLimit
+
+	// Retired keys must stay published for at least as long as the tokens they signed.
+	signingKeyGracePeriod, err := s.duration("SIGNING_KEY_GRACE_PERIOD", config.RefreshTokenExpiredIn)
+	if err != nil {
+		return Config{}, err
+	}
+	config.SigningKeyGracePeriod = signingKeyGracePeriod
+
+	argon2Memory, err := s.int("ARGON2_MEMORY", 64*1024)
+	if err != nil {
+		return Config{}, err
+	}
+	config.Argon2Memory = argon2Memory
+
+	argon2Time, err := s.int("ARGON2_TIME", 3)
+	if err != nil {
+		return Config{}, err
+	}
+	config.Argon2Time = argon2Time
+
+	argon2Parallelism, err := s.int("ARGON2_PARALLELISM", 2)
+	if err != nil {
+		return Config{}, err
+	}
+	config.Argon2Parallelism = argon2Parallelism
+
+	bcryptCost, err := s.int("BCRYPT_COST", 10)
+	if err != nil {
+		return Config{}, err
+	}
+	config.BcryptCost = bcryptCost
+
+	passwordMinLength, err := s.int("PASSWORD_MIN_LENGTH", 8)
+	if err != nil {
+		return Config{}, err
+	}
+	config.PasswordMinLength = passwordMinLength
+
+	// bcrypt cannot hash longer passwords, see Validate.
+	defaultPasswordMaxLength := 128
+	if config.PasswordHashAlgorithm == "bcrypt" {
+		defaultPasswordMaxLength = 72
+	}
+	passwordMaxLength, err := s.int("PASSWORD_MAX_LENGTH", defaultPasswordMaxLength)
+	if err != nil {
+		return Config{}, err
+	}
+	config.PasswordMaxLength = passwordMaxLength
+
+	passwordMinCharacterClasses, err := s.int("PASSWORD_MIN_CHARACTER_CLASSES", 2)
+	if err != nil {
+		return Config{}, err
+	}
+	config.PasswordMinCharacterClasses = passwordMinCharacterClasses
+
+	requestTimeout, err := s.duration("REQUEST_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return Config{}, err
+	}
+	config.RequestTimeout = requestTimeout
+
+	dbTimeout, err := s.duration("DB_TIMEOUT", 5*time.Second)
+	if err != nil {
+		return Config{}, err
+	}
+	config.DBTimeout = dbTimeout
+
+	redisTimeout, err := s.duration("REDIS_TIMEOUT", 2*time.Second)
+	if err != nil {
+		return Config{}, err
+	}
+	config.RedisTimeout = redisTimeout
+
+	requireEmailVerification, err := s.bool("REQUIRE_EMAIL_VERIFICATION", false)
+	if err != nil {
+		return Config{}, err
+	}
+	config.RequireEmailVerification = requireEmailVerification
+
+	enumerationSafeRegistration, err := s.bool("ENUMERATION_SAFE_REGISTRATION", false)
+	if err != nil {
+		return Config{}, err
+	}
+	config.EnumerationSafeRegistration = enumerationSafeRegistration
+
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+
 	return config, nil
 }
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"encoding/base64"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setRequired sets the settings that have no usable default, choosing the
+// drivers that need nothing else.
+func setRequired(t *testing.T) {
+	t.Helper()
+
+	t.Setenv("DATABASE_DRIVER", "sqlite")
+	t.Setenv("CACHE_DRIVER", "memory")
+	t.Setenv("MAIL_DRIVER", "log")
+	t.Setenv("MFA_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	for _, test := range []struct {
+		name             string
+		env, file, flags string
+		want             string
+	}{
+		{name: "default", want: "8080"},
+		{name: "flag", flags: "9003", want: "9003"},
+		{name: "file over flag", file: "9002", flags: "9003", want: "9002"},
+		{name: "environment over file and flag", env: "9001", file: "9002", flags: "9003", want: "9001"},
+		{name: "environment over file", env: "9001", file: "9002", want: "9001"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			setRequired(t)
+			// An empty variable counts as unset.
+			t.Setenv("PORT", test.env)
+
+			path := ""
+			if test.file != "" {
+				path = filepath.Join(t.TempDir(), "config.yaml")
+				if err := os.WriteFile(path, []byte("port: "+test.file+"\n"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			RegisterFlags(flags)
+			var args []string
+			if test.flags != "" {
+				args = []string{"-port", test.flags}
+			}
+			if err := flags.Parse(args); err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := Load(path, flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Port != test.want {
+				t.Fatalf("got PORT %s, want %s", config.Port, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsUnknownFileSettings(t *testing.T) {
+	setRequired(t)
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"prot": "9002"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(path, nil); err == nil || !strings.Contains(err.Error(), `unknown setting "prot"`) {
+		t.Fatalf("got %v, want the misspelled setting reported", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		change func(*Config)
+		want   []string
+	}{
+		{
+			name:   "valid",
+			change: func(*Config) {},
+		},
+		{
+			name:   "port",
+			change: func(c *Config) { c.Port = "http" },
+			want:   []string{`PORT must be a port number, got "http"`},
+		},
+		{
+			name:   "redis address",
+			change: func(c *Config) { c.CacheDriver, c.RedisAddr = "redis", "localhost" },
+			want:   []string{`REDIS_ADDR must be host:port, got "localhost"`},
+		},
+		{
+			name:   "duration",
+			change: func(c *Config) { c.AccessTokenExpiredIn = 0 },
+			want:   []string{"ACCESS_TOKEN_EXPIRED_IN must be a positive duration, got 0s"},
+		},
+		{
+			name:   "mfa key",
+			change: func(c *Config) { c.MFAEncryptionKey = base64.StdEncoding.EncodeToString(make([]byte, 16)) },
+			want:   []string{"MFA_ENCRYPTION_KEY must be a base64-encoded 32-byte key"},
+		},
+		{
+			name:   "signing key grace period",
+			change: func(c *Config) { c.SigningKeyGracePeriod = time.Minute },
+			want:   []string{"SIGNING_KEY_GRACE_PERIOD must be at least REFRESH_TOKEN_EXPIRED_IN (1h0m0s), got 1m0s"},
+		},
+		{
+			name: "every error at once",
+			change: func(c *Config) {
+				c.Port = ""
+				c.MailDriver, c.SMTPHost, c.SMTPPort, c.MailFrom = "smtp", "", "", ""
+			},
+			want: []string{
+				`PORT must be a port number, got ""`,
+				"SMTP_HOST is required for the smtp mail driver",
+				"SMTP_PORT is required for the smtp mail driver",
+				"MAIL_FROM is required for the smtp mail driver",
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			setRequired(t)
+			config, err := Load("", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			test.change(&config)
+			err = config.Validate()
+			if len(test.want) == 0 {
+				if err != nil {
+					t.Fatalf("got %v, want a valid config", err)
+				}
+				return
+			}
+
+			joined, ok := err.(interface{ Unwrap() []error })
+			if !ok {
+				t.Fatalf("got %v, want the joined errors %q", err, test.want)
+			}
+			errs := joined.Unwrap()
+			if len(errs) != len(test.want) {
+				t.Fatalf("got %d errors %v, want %d", len(errs), err, len(test.want))
+			}
+			for i, want := range test.want {
+				if !strings.HasPrefix(errs[i].Error(), want) {
+					t.Errorf("error %d: got %q, want %q", i, errs[i], want)
+				}
+			}
+		})
+	}
+}
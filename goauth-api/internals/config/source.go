@@ -0,0 +1,183 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// source looks settings up by their environment variable name, in order of
+// precedence: environment, config file, flags. The README explains the order.
+type source struct {
+	file  map[string]string
+	flags map[string]string
+}
+
+func newSource(path string, flags *flag.FlagSet) (*source, error) {
+	// Variables already in the environment win over the .env file.
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read .env: %v", err)
+	}
+
+	s := &source{file: map[string]string{}, flags: map[string]string{}}
+	if path != "" {
+		file, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		s.file = file
+	}
+
+	if flags != nil {
+		flags.Visit(func(f *flag.Flag) {
+			if key, ok := flagKeys[f.Name]; ok {
+				s.flags[key] = f.Value.String()
+			}
+		})
+	}
+
+	return s, nil
+}
+
+func (s *source) lookup(key string) (string, bool) {
+	if value := os.Getenv(key); value != "" {
+		return value, true
+	}
+	if value, ok := s.file[key]; ok {
+		return value, true
+	}
+	value, ok := s.flags[key]
+	return value, ok
+}
+
+// string returns the setting key, or fallback when it is unset.
+func (s *source) string(key, fallback string) string {
+	if value, ok := s.lookup(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// list splits a comma-separated setting, returning the parts of fallback when it is unset.
+func (s *source) list(key, fallback string) []string {
+	parts := strings.Split(s.string(key, fallback), ",")
+	for i, part := range parts {
+		parts[i] = strings.TrimSpace(part)
+	}
+	return parts
+}
+
+// duration parses key as a time.Duration, returning fallback when it is unset.
+func (s *source) duration(key string, fallback time.Duration) (time.Duration, error) {
+	value, ok := s.lookup(key)
+	if !ok {
+		return fallback, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", key, err)
+	}
+	return duration, nil
+}
+
+// int parses key as an int, returning fallback when it is unset.
+func (s *source) int(key string, fallback int) (int, error) {
+	value, ok := s.lookup(key)
+	if !ok {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", key, err)
+	}
+	return n, nil
+}
+
+// bool parses key as a bool, returning fallback when it is unset.
+func (s *source) bool(key string, fallback bool) (bool, error) {
+	value, ok := s.lookup(key)
+	if !ok {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", key, err)
+	}
+	return b, nil
+}
+
+// readFile reads a YAML or JSON file of settings keyed by their environment
+// variable name, in any case. Lists may be given as sequences.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	// JSON is a subset of YAML, so one decoder reads both.
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	settings := make(map[string]string, len(raw))
+	for name, value := range raw {
+		key := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		if _, ok := keys[key]; !ok {
+			return nil, fmt.Errorf("config file %s: unknown setting %q", path, name)
+		}
+
+		switch value := value.(type) {
+		case nil:
+		case []interface{}:
+			parts := make([]string, 0, len(value))
+			for _, part := range value {
+				parts = append(parts, fmt.Sprint(part))
+			}
+			settings[key] = strings.Join(parts, ",")
+		default:
+			settings[key] = fmt.Sprint(value)
+		}
+	}
+
+	return settings, nil
+}
+
+// RegisterFlags adds a flag for every setting to flags, named after its
+// environment variable, so PORT becomes -port and DB_HOST becomes -db-host.
+func RegisterFlags(flags *flag.FlagSet) {
+	for name, key := range flagKeys {
+		flags.String(name, "", "sets "+key)
+	}
+}
+
+// keys holds the environment variable name of every setting, from the envconfig tags of Config.
+var keys = settingKeys()
+
+// flagKeys maps each flag added by RegisterFlags to its setting.
+var flagKeys = func() map[string]string {
+	names := make(map[string]string, len(keys))
+	for key := range keys {
+		names[strings.ToLower(strings.ReplaceAll(key, "_", "-"))] = key
+	}
+	return names
+}()
+
+func settingKeys() map[string]struct{} {
+	configType := reflect.TypeOf(Config{})
+	keys := make(map[string]struct{}, configType.NumField())
+	for i := 0; i < configType.NumField(); i++ {
+		if key := configType.Field(i).Tag.Get("envconfig"); key != "" {
+			keys[key] = struct{}{}
+		}
+	}
+	return keys
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Validate reports every invalid setting at once, so a misconfigured
+// deployment fails at startup instead of on the first request that needs it.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	port, err := strconv.Atoi(c.Port)
+	check(err == nil && port > 0 && port < 65536, "PORT must be a port number, got %q", c.Port)
+
+	switch c.DatabaseDriver {
+	case "postgres":
+		check(c.DBHost != "", "DB_HOST is required for the postgres database driver")
+		check(c.DBName != "", "DB_NAME is required for the postgres database driver")
+	case "sqlite":
+		check(c.SQLiteDSN != "", "SQLITE_DSN is required for the sqlite database driver")
+	default:
+		check(false, "DATABASE_DRIVER must be postgres or sqlite, got %q", c.DatabaseDriver)
+	}
+
+	switch c.CacheDriver {
+	case "redis":
+		_, _, err := net.SplitHostPort(c.RedisAddr)
+		check(err == nil, "REDIS_ADDR must be host:port, got %q", c.RedisAddr)
+	case "memory":
+	default:
+		check(false, "CACHE_DRIVER must be redis or memory, got %q", c.CacheDriver)
+	}
+
+	for _, setting := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"ACCESS_TOKEN_EXPIRED_IN", c.AccessTokenExpiredIn},
+		{"REFRESH_TOKEN_EXPIRED_IN", c.RefreshTokenExpiredIn},
+		{"VERIFICATION_TOKEN_EXPIRED_IN", c.VerificationTokenExpiredIn},
+		{"PASSWORD_RESET_TOKEN_EXPIRED_IN", c.PasswordResetTokenExpiredIn},
+		{"MFA_TOKEN_EXPIRED_IN", c.MFATokenExpiredIn},
+		{"WEBAUTHN_CHALLENGE_EXPIRED_IN", c.WebAuthnChallengeExpiredIn},
+		{"OAUTH_CODE_EXPIRED_IN", c.OAuthCodeExpiredIn},
+		{"ID_TOKEN_EXPIRED_IN", c.IDTokenExpiredIn},
+		{"API_KEY_EXPIRED_IN", c.APIKeyExpiredIn},
+		{"LOGIN_FAILURE_WINDOW", c.LoginFailureWindow},
+		{"LOGIN_LOCKOUT_DURATION", c.LoginLockoutDuration},
+	} {
+		check(setting.value > 0, "%s must be a positive duration, got %s", setting.key, setting.value)
+	}
+
+	// These may be zero to turn the feature off, but never negative.
+	for _, setting := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"REQUEST_TIMEOUT", c.RequestTimeout},
+		{"DB_TIMEOUT", c.DBTimeout},
+		{"REDIS_TIMEOUT", c.RedisTimeout},
+		{"REFRESH_TOKEN_REUSE_GRACE", c.RefreshTokenReuseGrace},
+		{"LOGIN_BACKOFF_BASE", c.LoginBackoffBase},
+		{"LOGIN_BACKOFF_MAX", c.LoginBackoffMax},
+		{"SIGNING_KEY_GRACE_PERIOD", c.SigningKeyGracePeriod},
+	} {
+		check(setting.value >= 0, "%s must not be negative, got %s", setting.key, setting.value)
+	}
+	// A key retired sooner would stop verifying refresh tokens it signed before they expire.
+	check(c.SigningKeyGracePeriod >= c.RefreshTokenExpiredIn,
+		"SIGNING_KEY_GRACE_PERIOD must be at least REFRESH_TOKEN_EXPIRED_IN (%s), got %s", c.RefreshTokenExpiredIn, c.SigningKeyGracePeriod)
+
+	for _, setting := range []struct {
+		key   string
+		value int
+	}{
+		{"LOGIN_BACKOFF_AFTER", c.LoginBackoffAfter},
+		{"LOGIN_LOCKOUT_THRESHOLD", c.LoginLockoutThreshold},
+		{"LOGIN_IP_FAILURE_LIMIT", c.LoginIPFailureLimit},
+		{"PASSWORD_MIN_LENGTH", c.PasswordMinLength},
+		{"PASSWORD_MAX_LENGTH", c.PasswordMaxLength},
+	} {
+		check(setting.value >= 0, "%s must not be negative, got %d", setting.key, setting.value)
+	}
+
+	// Without the key, two-factor enrollment would only fail once a user tries it.
+	mfaKey, err := base64.StdEncoding.DecodeString(c.MFAEncryptionKey)
+	check(err == nil && len(mfaKey) == 32, "MFA_ENCRYPTION_KEY must be a base64-encoded 32-byte key, such as the output of openssl rand -base64 32")
+
+	check(len(c.WebAuthnOrigins) > 0 && c.WebAuthnOrigins[0] != "", "WEBAUTHN_ORIGINS must list at least one origin")
+	check(c.OIDCIssuer != "", "OIDC_ISSUER is required")
+	check(c.SigningKeyDir != "", "SIGNING_KEY_DIR is required")
+
+	check(slices.Contains([]string{"argon2id", "bcrypt"}, c.PasswordHashAlgorithm),
+		"PASSWORD_HASH_ALGORITHM must be argon2id or bcrypt, got %q", c.PasswordHashAlgorithm)
+	if c.PasswordHashAlgorithm == "bcrypt" {
+		// Longer passwords would fail to hash; the policy also caps them at 72 bytes.
+		check(c.PasswordMaxLength > 0 && c.PasswordMaxLength <= 72,
+			"PASSWORD_MAX_LENGTH must be between 1 and 72 with bcrypt, which hashes at most 72 bytes, got %d", c.PasswordMaxLength)
+	}
+	check(c.Argon2Memory > 0 && c.Argon2Time > 0 && c.Argon2Parallelism > 0 && c.Argon2Parallelism < 256,
+		"ARGON2_MEMORY, ARGON2_TIME and ARGON2_PARALLELISM must be positive, and ARGON2_PARALLELISM below 256")
+	check(c.BcryptCost >= 4 && c.BcryptCost <= 31, "BCRYPT_COST must be between 4 and 31, got %d", c.BcryptCost)
+	check(c.PasswordMaxLength == 0 || c.PasswordMaxLength >= c.PasswordMinLength,
+		"PASSWORD_MAX_LENGTH must not be below PASSWORD_MIN_LENGTH")
+	check(c.PasswordMinCharacterClasses >= 0 && c.PasswordMinCharacterClasses <= 4,
+		"PASSWORD_MIN_CHARACTER_CLASSES must be between 0 and 4, got %d", c.PasswordMinCharacterClasses)
+
+	for _, sink := range c.AuditSinks {
+		check(sink == "postgres" || sink == "file", "AUDIT_SINKS may only list postgres and file, got %q", sink)
+	}
+	if slices.Contains(c.AuditSinks, "file") {
+		check(c.AuditLogFile != "", "AUDIT_LOG_FILE is required for the file audit sink")
+	}
+
+	switch c.MailDriver {
+	case "smtp":
+		check(c.SMTPHost != "", "SMTP_HOST is required for the smtp mail driver")
+		check(c.SMTPPort != "", "SMTP_PORT is required for the smtp mail driver")
+		check(c.MailFrom != "", "MAIL_FROM is required for the smtp mail driver")
+	case "log":
+	default:
+		check(false, "MAIL_DRIVER must be smtp or log, got %q", c.MailDriver)
+	}
+
+	return errors.Join(errs...)
+}
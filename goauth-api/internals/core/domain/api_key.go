@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKeyPrefix starts every API key so leaked keys are easy to recognize.
+const APIKeyPrefix = "gak_"
+
+// APIKey lets a service account authenticate with `Authorization: ApiKey <key>`.
+// Only Prefix is stored in the clear; the secret part is kept as a hash.
+type APIKey struct {
+	CommonModel
+	ServiceAccountID uuid.UUID  `gorm:"type:uuid;index" json:"service_account_id"`
+	Name             string     `json:"name"`
+	Prefix           string     `gorm:"uniqueIndex" json:"prefix"`
+	SecretHash       string     `json:"-"`
+	Scopes           []string   `gorm:"serializer:json" json:"scopes"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	LastUsedAt       *time.Time `json:"last_used_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+}
+
+type CreateServiceAccountRequest struct {
+	Username string `json:"username"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateAPIKeyResponse carries the full key, which is only ever shown once.
+type CreateAPIKeyResponse struct {
+	*APIKey
+	Key string `json:"key"`
+}
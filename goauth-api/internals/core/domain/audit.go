@@ -0,0 +1,54 @@
+package domain
+
+import "time"
+
+const (
+	AuditEventRegister        = "register"
+	AuditEventLogin           = "login"
+	AuditEventRefresh         = "refresh"
+	AuditEventLogout          = "logout"
+	AuditEventPasswordChange  = "password_change"
+	AuditEventRoleChange      = "role_change"
+	AuditEventTokenRevocation = "token_revocation"
+	AuditEventAccountLockout  = "account_lockout"
+	AuditEventAccountUnlock   = "account_unlock"
+	// AuditEventRefreshTokenReuse is recorded when a rotated refresh token is
+	// presented again and the login it belonged to is ended.
+	AuditEventRefreshTokenReuse = "refresh_token_reuse"
+)
+
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditEvent records who did what to whom, and from where. ActorID is a user
+// ID or, for OAuth clients acting for themselves, a client ID.
+type AuditEvent struct {
+	CommonModel
+	Type      string `gorm:"index" json:"type"`
+	ActorID   string `gorm:"index" json:"actor_id,omitempty"`
+	TargetID  string `gorm:"index" json:"target_id,omitempty"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Outcome   string `json:"outcome"`
+	Details   string `json:"details,omitempty"`
+}
+
+type AuditFilter struct {
+	Type     string
+	ActorID  string
+	TargetID string
+	Outcome  string
+	IP       string
+	Since    *time.Time
+	Until    *time.Time
+	// Cursor is the NextCursor of the previous page, or empty for the newest events.
+	Cursor string
+	Limit  int
+}
+
+type AuditPage struct {
+	Events     []*AuditEvent `json:"events"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
@@ -4,3 +4,45 @@ type Book struct {
 	CommonModel
 	Title string `json:"title"`
 }
+
+// Book sort orders. A leading - sorts newest first.
+const (
+	BookSortCreatedAsc  = "created_at"
+	BookSortCreatedDesc = "-created_at"
+	BookSortUpdatedAsc  = "updated_at"
+	BookSortUpdatedDesc = "-updated_at"
+)
+
+type BookRequest struct {
+	Title string `json:"title"`
+}
+
+// BookUpdate changes the fields that are set and leaves the others as they are.
+type BookUpdate struct {
+	Title *string `json:"title"`
+}
+
+type BookFilter struct {
+	// Title matches books whose title contains it, ignoring case.
+	Title string
+	// Deleted lists deleted books instead of the others, so they can be restored.
+	Deleted bool
+	// Sort is one of the BookSort orders and defaults to BookSortCreatedDesc.
+	Sort string
+	// Cursor is the NextCursor of the previous page. It cannot be combined with Offset.
+	Cursor string
+	Offset int
+	Limit  int
+}
+
+type BookPageMeta struct {
+	Total      int64  `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type BookPage struct {
+	Books []*Book      `json:"books"`
+	Meta  BookPageMeta `json:"meta"`
+}
@@ -0,0 +1,102 @@
+package domain
+
+// Error is a failure the caller can act on. Code is stable and meant for
+// clients to branch on; Message is for people and may change.
+// An error matches its Kind with errors.Is, so callers can handle a whole
+// class of failures, such as anything not found, without listing each one.
+type Error struct {
+	Kind    *Error
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	if e.Kind == nil {
+		return nil
+	}
+	return e.Kind
+}
+
+// NewError returns an error of the given kind.
+func NewError(kind *Error, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// ValidationError reports a request that cannot be processed as sent.
+func ValidationError(message string) *Error {
+	return NewError(ErrInvalidInput, ErrInvalidInput.Code, message)
+}
+
+// Kinds of errors. Adapters decide how to report an error by its kind.
+var (
+	ErrInvalidInput = &Error{Code: "invalid_input", Message: "invalid input"}
+	ErrUnauthorized = &Error{Code: "unauthorized", Message: "authentication required"}
+	ErrForbidden    = &Error{Code: "forbidden", Message: "forbidden"}
+	ErrNotFound     = &Error{Code: "not_found", Message: "not found"}
+	ErrConflict     = &Error{Code: "conflict", Message: "conflict"}
+	ErrTokenInvalid = &Error{Code: "token_invalid", Message: "token is invalid"}
+	ErrTokenExpired = &Error{Code: "token_expired", Message: "token has expired"}
+	ErrTokenReused  = &Error{Code: "token_reused", Message: "token has already been used"}
+	ErrRateLimited  = &Error{Code: "rate_limited", Message: "too many requests"}
+)
+
+// Accounts.
+var (
+	// ErrInvalidCredentials is returned for an unknown email or a wrong password alike.
+	ErrInvalidCredentials = NewError(ErrUnauthorized, "invalid_credentials", "invalid email or password")
+	ErrEmailNotVerified   = NewError(ErrForbidden, "email_not_verified", "email address not verified")
+	ErrUserNotFound       = NewError(ErrNotFound, "user_not_found", "user not found")
+	ErrEmailTaken         = NewError(ErrConflict, "email_taken", "user with this email already exists")
+	ErrUsernameTaken      = NewError(ErrConflict, "username_taken", "user with this username already exists")
+	ErrPasswordPolicy     = NewError(ErrInvalidInput, "password_policy", "password does not meet the policy")
+	ErrAccountLocked      = NewError(ErrRateLimited, "account_locked", "account is temporarily locked after too many failed login attempts")
+	ErrTooManyLogins      = NewError(ErrRateLimited, "too_many_login_attempts", "too many failed login attempts, try again later")
+)
+
+// Tokens and sessions.
+var (
+	ErrAccessTokenInvalid     = NewError(ErrTokenInvalid, "access_token_invalid", "access token is invalid or has been revoked")
+	ErrRefreshTokenMissing    = NewError(ErrUnauthorized, "refresh_token_missing", "refresh token not provided")
+	ErrRefreshTokenInvalid    = NewError(ErrTokenInvalid, "refresh_token_invalid", "invalid refresh token")
+	ErrRefreshTokenExpired    = NewError(ErrTokenExpired, "refresh_token_expired", "refresh token expired")
+	ErrRefreshTokenReused     = NewError(ErrTokenReused, "refresh_token_reused", "refresh token reuse detected")
+	ErrSingleUseTokenUsed     = NewError(ErrTokenReused, "token_used", "token is invalid or has already been used")
+	ErrSessionNotFound        = NewError(ErrNotFound, "session_not_found", "session not found")
+	ErrAuthenticationRequired = NewError(ErrUnauthorized, "authentication_required", "authentication required")
+	ErrUserRequired           = NewError(ErrForbidden, "user_required", "this endpoint requires a user")
+	ErrPermissionDenied       = NewError(ErrForbidden, "permission_denied", "missing permission")
+)
+
+// Two-factor authentication and passkeys.
+var (
+	ErrMFAAlreadyEnabled       = NewError(ErrConflict, "mfa_already_enabled", "two-factor authentication is already enabled")
+	ErrMFANotEnabled           = NewError(ErrConflict, "mfa_not_enabled", "two-factor authentication is not enabled")
+	ErrMFAEnrollmentNotStarted = NewError(ErrConflict, "mfa_enrollment_not_started", "two-factor authentication enrollment has not been started")
+	ErrMFATokenInvalid         = NewError(ErrTokenInvalid, "mfa_token_invalid", "mfa token is invalid or has expired")
+	ErrMFACodeInvalid          = NewError(ErrUnauthorized, "mfa_code_invalid", "invalid two-factor code")
+	ErrChallengeInvalid        = NewError(ErrTokenInvalid, "challenge_invalid", "challenge is invalid or has expired")
+	ErrPasskeyUnknown          = NewError(ErrUnauthorized, "passkey_unknown", "unknown passkey")
+	ErrPasskeyRejected         = NewError(ErrUnauthorized, "passkey_rejected", "passkey verification failed")
+)
+
+// API keys, roles and OAuth clients.
+var (
+	ErrAPIKeyInvalid          = NewError(ErrUnauthorized, "api_key_invalid", "invalid api key")
+	ErrAPIKeyRevoked          = NewError(ErrUnauthorized, "api_key_revoked", "api key has been revoked")
+	ErrAPIKeyExpired          = NewError(ErrTokenExpired, "api_key_expired", "api key has expired")
+	ErrAPIKeyNotFound         = NewError(ErrNotFound, "api_key_not_found", "api key not found")
+	ErrServiceAccountNotFound = NewError(ErrNotFound, "service_account_not_found", "service account not found")
+	ErrRoleNotFound           = NewError(ErrNotFound, "role_not_found", "role not found")
+	ErrLastAdmin              = NewError(ErrConflict, "last_admin", "cannot remove the last admin")
+	ErrOAuthClientNotFound    = NewError(ErrNotFound, "oauth_client_not_found", "oauth client not found")
+)
+
+// Books.
+var (
+	ErrBookNotFound   = NewError(ErrNotFound, "book_not_found", "book not found")
+	ErrBookNotDeleted = NewError(ErrConflict, "book_not_deleted", "book is not deleted")
+)
@@ -0,0 +1,170 @@
+package domain
+
+import "github.com/google/uuid"
+
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+type OAuthClient struct {
+	CommonModel
+	ClientID     string    `gorm:"uniqueIndex" json:"client_id"`
+	SecretHash   string    `json:"-"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `gorm:"serializer:json" json:"redirect_uris"`
+	Confidential bool      `json:"confidential"`
+	OwnerID      uuid.UUID `gorm:"type:uuid;index" json:"owner_id"`
+	// GrantTypes the client may use. Clients registered before grant types
+	// were recorded have none and get authorization_code and refresh_token.
+	GrantTypes []string `gorm:"serializer:json" json:"grant_types"`
+	// Scopes are the permissions the client may request for itself with client_credentials.
+	Scopes []string `gorm:"serializer:json" json:"scopes"`
+}
+
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Confidential bool     `json:"confidential"`
+	GrantTypes   []string `json:"grant_types"`
+	Scopes       []string `json:"scopes"`
+}
+
+type CreateOAuthClientResponse struct {
+	*OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// Answers to a consent prompt.
+const (
+	ConsentApprove = "approve"
+	ConsentDeny    = "deny"
+)
+
+// AuthorizationRequest is read from the query of GET /oauth/authorize, or from
+// the body of the POST that answers a consent prompt.
+type AuthorizationRequest struct {
+	ResponseType        string `query:"response_type" form:"response_type" json:"response_type"`
+	ClientID            string `query:"client_id" form:"client_id" json:"client_id"`
+	RedirectURI         string `query:"redirect_uri" form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `query:"scope" form:"scope" json:"scope"`
+	State               string `query:"state" form:"state" json:"state"`
+	CodeChallenge       string `query:"code_challenge" form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `query:"code_challenge_method" form:"code_challenge_method" json:"code_challenge_method"`
+	Nonce               string `query:"nonce" form:"nonce" json:"nonce"`
+	// Consent is the user's answer to the consent prompt, ConsentApprove or
+	// ConsentDeny. It is only taken from a POST, never from a link.
+	Consent string `query:"-" form:"consent" json:"consent"`
+}
+
+// AuthorizationResult either redirects the user agent back to the client or,
+// when the user has not yet agreed to give the client what it asks for, asks them.
+type AuthorizationResult struct {
+	RedirectURL string
+	Consent     *ConsentPrompt
+}
+
+// ConsentPrompt describes what the user is asked to agree to.
+type ConsentPrompt struct {
+	ClientID   string `json:"client_id"`
+	ClientName string `json:"client_name"`
+	Scope      string `json:"scope"`
+}
+
+// OAuthConsent records the scope a user has agreed to give a client, so they
+// are not asked again for the same or a narrower scope.
+type OAuthConsent struct {
+	CommonModel
+	UserID   uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_oauth_consent" json:"-"`
+	ClientID string    `gorm:"uniqueIndex:idx_oauth_consent" json:"client_id"`
+	Scope    string    `json:"scope"`
+}
+
+// AuthorizationCode is what an issued code refers to while it waits in the cache.
+type AuthorizationCode struct {
+	ClientID string `json:"client_id"`
+	UserID   string `json:"user_id"`
+	// RedirectURI is the redirect_uri parameter as sent, which is empty when the
+	// client relied on its only registered URI. The token request must repeat it.
+	RedirectURI   string `json:"redirect_uri"`
+	Scope         string `json:"scope"`
+	CodeChallenge string `json:"code_challenge"`
+	Nonce         string `json:"nonce,omitempty"`
+	AuthTime      int64  `json:"auth_time"`
+}
+
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// Token type hints and introspected token types, as registered by RFC 7009.
+const (
+	TokenTypeAccessToken  = "access_token"
+	TokenTypeRefreshToken = "refresh_token"
+)
+
+type IntrospectionRequest struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+type RevocationRequest struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// IntrospectionResponse is defined by RFC 7662 section 2.2. Only Active is set for tokens that are not live.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	TokenID   string `json:"jti,omitempty"`
+}
+
+// OAuthError is an error response as defined in RFC 6749 section 5.2.
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	Status      int    `json:"-"`
+	// Err is the failure behind the response, if any, such as a detected
+	// refresh token reuse that services act on.
+	Err error `json:"-"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func (e *OAuthError) Unwrap() error {
+	return e.Err
+}
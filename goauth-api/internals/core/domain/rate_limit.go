@@ -0,0 +1,20 @@
+package domain
+
+import "time"
+
+// RateLimitError means the request was refused until RetryAfter has passed.
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *RateLimitError) Error() string {
+	return e.Unwrap().Error()
+}
+
+func (e *RateLimitError) Unwrap() error {
+	if e.Locked {
+		return ErrAccountLocked
+	}
+	return ErrTooManyLogins
+}
@@ -0,0 +1,38 @@
+package domain
+
+// Permissions are checked by the RequirePermission middleware.
+const (
+	PermissionBooksRead     = "books:read"
+	PermissionBooksWrite    = "books:write"
+	PermissionRolesManage   = "roles:manage"
+	PermissionAPIKeysManage = "api_keys:manage"
+	PermissionUsersUnlock   = "users:unlock"
+	PermissionAuditRead     = "audit:read"
+	// PermissionOAuthClientsManage allows registering OAuth clients, which may
+	// then ask any user for access.
+	PermissionOAuthClientsManage = "oauth_clients:manage"
+)
+
+// Roles seeded on startup. New users are given RoleUser.
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleUser   = "user"
+)
+
+type Role struct {
+	CommonModel
+	Name        string       `gorm:"uniqueIndex" json:"name"`
+	Description string       `json:"description"`
+	Permissions []Permission `gorm:"many2many:role_permissions;" json:"permissions"`
+}
+
+type Permission struct {
+	CommonModel
+	Name        string `gorm:"uniqueIndex" json:"name"`
+	Description string `json:"description"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role"`
+}
@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+// ClientInfo describes the device a login or refresh request came from.
+type ClientInfo struct {
+	IP          string
+	UserAgent   string
+	DeviceLabel string
+}
+
+// Session is a login as seen by its owner. Its ID is the refresh token family ID.
+type Session struct {
+	ID          string    `json:"id"`
+	DeviceLabel string    `json:"device_label"`
+	IP          string    `json:"ip"`
+	UserAgent   string    `json:"user_agent"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastUsedAt  time.Time `json:"last_used_at"`
+	Current     bool      `json:"current"`
+}
@@ -2,6 +2,19 @@ package domain
 
 import "github.com/golang-jwt/jwt/v5"
 
+// Token uses are carried in the token_use claim. All tokens are signed by the
+// same key ring, so this is what stops one kind of token being accepted as another.
+const (
+	TokenUseAccess            = "access"
+	TokenUseRefresh           = "refresh"
+	TokenUseEmailVerification = "email_verification"
+	TokenUsePasswordReset     = "password_reset"
+	TokenUseMFAPending        = "mfa_pending"
+	// TokenUseAPIKey marks claims built for a request authenticated with an API
+	// key. No token with this use is ever signed.
+	TokenUseAPIKey = "api_key"
+)
+
 type Tokens struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
@@ -18,5 +31,27 @@ type JWTCustomClaims struct {
 	UserID   string `json:"userId"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
+	TokenUse string `json:"token_use"`
+	FamilyID string `json:"fid,omitempty"`
+	// ClientID names the OAuth client the token was issued to. It is set
+	// instead of UserID on tokens a client got for itself, and alongside it on
+	// tokens a client got on a user's behalf.
+	ClientID string `json:"client_id,omitempty"`
+	// Scope limits the caller to these space-separated permissions. Clients and
+	// API keys hold exactly these; a client acting for a user holds those of
+	// them the user has.
+	Scope string `json:"scope,omitempty"`
 	jwt.RegisteredClaims
 }
+
+// IsClient reports whether the claims belong to an OAuth client acting for
+// itself through the client_credentials grant, with no user behind it.
+func (c *JWTCustomClaims) IsClient() bool {
+	return c.ClientID != "" && c.UserID == ""
+}
+
+// IsDelegated reports whether the claims belong to a token a user gave an
+// OAuth client through the authorization code grant.
+func (c *JWTCustomClaims) IsDelegated() bool {
+	return c.ClientID != "" && c.UserID != ""
+}
@@ -0,0 +1,17 @@
+package domain
+
+// RefreshTokenReuseError means a refresh token was presented after it had been
+// rotated, and the login it belonged to has been ended.
+type RefreshTokenReuseError struct {
+	UserID   string
+	FamilyID string
+	TokenID  string
+}
+
+func (e *RefreshTokenReuseError) Error() string {
+	return e.Unwrap().Error()
+}
+
+func (e *RefreshTokenReuseError) Unwrap() error {
+	return ErrRefreshTokenReused
+}
@@ -4,25 +4,41 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type CommonModel struct {
-	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 	DeletedAt *time.Time `gorm:"index" json:"deleted_at"`
 }
 
+// BeforeCreate assigns the ID in Go rather than through a database default, so
+// the same schema works on every supported database.
+func (m *CommonModel) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
 type User struct {
 	CommonModel
-	Email    string
-	Username string
-	Password string
+	Email          string
+	Username       string
+	Password       string `json:"-"`
+	VerifiedAt     *time.Time
+	TOTPSecret     string `json:"-"`
+	TOTPEnabled    bool
+	ServiceAccount bool
+	Roles          []Role `gorm:"many2many:user_roles;"`
 }
 
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	DeviceName string `json:"device_name"`
 }
 
 type RegisterRequest struct {
@@ -31,10 +47,29 @@ type RegisterRequest struct {
 	Password string `json:"password"`
 }
 
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
 type LoginResponse struct {
 	CommonModel
 	Email        string `gorm:"uniqueIndex" json:"email"`
 	Username     string `json:"username"`
 	AccessToken  string `json:"-"`
 	RefreshToken string `json:"-"`
+	MFARequired  bool   `json:"mfa_required,omitempty"`
+	MFAToken     string `json:"mfa_token,omitempty"`
 }
@@ -0,0 +1,18 @@
+package ports
+
+import (
+	"context"
+	"go-chat/internals/core/domain"
+)
+
+type AuditSink interface {
+	Write(ctx context.Context, event *domain.AuditEvent) error
+}
+
+type AuditRepository interface {
+	ListAuditEvents(ctx context.Context, filter *domain.AuditFilter) (*domain.AuditPage, error)
+}
+type AuditService interface {
+	Record(ctx context.Context, event *domain.AuditEvent)
+	ListAuditEvents(ctx context.Context, filter *domain.AuditFilter) (*domain.AuditPage, error)
+}
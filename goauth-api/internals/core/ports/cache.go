@@ -1,9 +1,32 @@
 package ports
 
-import "time"
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrCacheMiss is returned by Get for a key that does not exist or has expired.
+var ErrCacheMiss = errors.New("cache miss")
 
 type CacheRepository interface {
-	Set(key string, value interface{}, expiration time.Duration) error
-	Get(key string, value interface{}) error
-	Delete(key string) error
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	// SetIfAbsent sets the key only if it does not exist and reports whether it
+	// did, so of several concurrent callers exactly one gets true.
+	SetIfAbsent(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
+	// Update reads the value at key into value, calls update and, if it
+	// reports a change, stores value with the given expiration, all as one
+	// step. If another caller changes the key in between, value is read again
+	// and update runs again. update must not use the cache itself.
+	Update(ctx context.Context, key string, value interface{}, expiration time.Duration, update func() (bool, error)) error
+	Get(ctx context.Context, key string, value interface{}) error
+	// Take gets the value at key and deletes it in one step, so of several
+	// concurrent callers only one gets the value; the others get ErrCacheMiss.
+	Take(ctx context.Context, key string, value interface{}) error
+	Delete(ctx context.Context, key string) error
+	AddToSet(ctx context.Context, key string, member string, expiration time.Duration) error
+	GetSetMembers(ctx context.Context, key string) ([]string, error)
+	RemoveFromSet(ctx context.Context, key string, member string) error
+	// Close releases the connection or background work of the cache.
+	Close() error
 }
@@ -0,0 +1,15 @@
+package ports
+
+import (
+	"context"
+	"time"
+)
+
+type LoginLimiter interface {
+	// Check returns a *domain.RateLimitError if a login for the account or from the IP must wait.
+	Check(ctx context.Context, account, ip string) error
+	// RecordFailure counts a failed login and reports when the account was locked because of it.
+	RecordFailure(ctx context.Context, account, ip string) (lockedUntil time.Time, locked bool, err error)
+	Reset(ctx context.Context, account string) error
+	Unlock(ctx context.Context, account string) error
+}
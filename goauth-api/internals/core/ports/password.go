@@ -0,0 +1,15 @@
+package ports
+
+type PasswordHasher interface {
+	// Hash returns a PHC-formatted hash of password using the current algorithm and parameters.
+	Hash(password string) (string, error)
+	// Verify reports whether password matches hash, and whether hash was made with outdated
+	// parameters or algorithm and should be replaced with a fresh Hash.
+	Verify(hash, password string) (ok bool, needsRehash bool, err error)
+}
+
+type PasswordPolicy interface {
+	// Check returns a *domain.PasswordPolicyError listing every broken rule. identities are
+	// values the password must not contain, such as the username and email.
+	Check(password string, identities ...string) error
+}
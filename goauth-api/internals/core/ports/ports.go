@@ -1,50 +1,169 @@
 package ports
 
 import (
+	"context"
 	"go-chat/internals/core/domain"
 	"time"
 )
 
 type UserService interface {
-	GetUserByUsername(username string) (*domain.User, error)
-	CreateUser(email, username, password string) (*domain.User, error)
-	LoginUser(email, password string) (*domain.LoginResponse, error)
-	LogoutUser(refreshToken string) error
-	RefreshTokens(refreshToken string) (*domain.LoginResponse, error)
+	GetUserByUsername(ctx context.Context, username string) (*domain.User, error)
+	CreateUser(ctx context.Context, email, username, password string) (*domain.User, error)
+	RegisterPrivately(ctx context.Context, email, username, password string) error
+	LoginUser(ctx context.Context, email, password string, client domain.ClientInfo) (*domain.LoginResponse, error)
+	LogoutUser(ctx context.Context, refreshToken string) (string, error)
+	RefreshTokens(ctx context.Context, refreshToken string, client domain.ClientInfo) (*domain.LoginResponse, error)
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, email string)
+	ForgotPassword(ctx context.Context, email string)
+	ResetPassword(ctx context.Context, token, newPassword string) (*domain.User, error)
+	UnlockAccount(ctx context.Context, userID string) error
 }
 
 type UserRepository interface {
-	GetUserByUsername(username string) (*domain.User, error)
-	CreateUser(email, username, password string) (*domain.User, error)
-	LoginUser(email, password string) (*domain.LoginResponse, error)
-	LogoutUser(refreshToken string) error
-	RefreshTokens(refreshToken string) (*domain.LoginResponse, error)
+	GetUserByUsername(ctx context.Context, username string) (*domain.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*domain.User, error)
+	CreateUser(ctx context.Context, email, username, password string) (*domain.User, error)
+	LoginUser(ctx context.Context, email, password string, client domain.ClientInfo) (*domain.LoginResponse, error)
+	LogoutUser(ctx context.Context, refreshToken string) (string, error)
+	RefreshTokens(ctx context.Context, refreshToken string, client domain.ClientInfo) (*domain.LoginResponse, error)
+	CreateEmailVerificationToken(ctx context.Context, user *domain.User) (string, error)
+	VerifyEmail(ctx context.Context, token string) (*domain.User, error)
+	CreatePasswordResetToken(ctx context.Context, user *domain.User) (string, error)
+	ResetPassword(ctx context.Context, token, newPassword string) (*domain.User, error)
+	GetUserByID(ctx context.Context, userID string) (*domain.User, error)
 }
 
 type BookRepository interface {
-	GetBooks() ([]*domain.Book, error)
-	CreateBook(title string) (*domain.Book, error)
+	GetBooks(ctx context.Context, filter *domain.BookFilter) (*domain.BookPage, error)
+	GetBook(ctx context.Context, id string) (*domain.Book, error)
+	CreateBook(ctx context.Context, title string) (*domain.Book, error)
+	UpdateBook(ctx context.Context, id string, update *domain.BookUpdate) (*domain.Book, error)
+	DeleteBook(ctx context.Context, id string) error
+	RestoreBook(ctx context.Context, id string) (*domain.Book, error)
 }
 
 type BookService interface {
-	GetBooks() ([]*domain.Book, error)
-	CreateBook(title string) (*domain.Book, error)
+	GetBooks(ctx context.Context, filter *domain.BookFilter) (*domain.BookPage, error)
+	GetBook(ctx context.Context, id string) (*domain.Book, error)
+	CreateBook(ctx context.Context, title string) (*domain.Book, error)
+	UpdateBook(ctx context.Context, id string, update *domain.BookUpdate) (*domain.Book, error)
+	DeleteBook(ctx context.Context, id string) error
+	RestoreBook(ctx context.Context, id string) (*domain.Book, error)
 }
 
 type TokenRepository interface {
-	SetRefreshToken(userID string, tokenID string, expiresIn time.Duration) error
-	DeleteRefreshToken(userID string, prevTokenID string) error
+	SetRefreshToken(ctx context.Context, userID string, tokenID string, expiresIn time.Duration) error
+	DeleteRefreshToken(ctx context.Context, userID string, prevTokenID string) error
 }
 type TokenService interface {
-	SetRefreshToken(userID string, tokenID string, expiresIn time.Duration) error
-	DeleteRefreshToken(userID string, prevTokenID string) error
+	SetRefreshToken(ctx context.Context, userID string, tokenID string, expiresIn time.Duration) error
+	DeleteRefreshToken(ctx context.Context, userID string, prevTokenID string) error
 }
 
 type AuthRepository interface {
-	GetUserTokenByID(tokenID string) (string, error)
-	GetUserByID(userID string) (*domain.User, error)
+	ParseAccessToken(ctx context.Context, accessToken string) (*domain.JWTCustomClaims, error)
+	GetUserTokenByID(ctx context.Context, tokenID string) (string, error)
+	GetUserByID(ctx context.Context, userID string) (*domain.User, error)
+	GetUserPermissions(ctx context.Context, userID string) ([]string, error)
+	AuthenticateAPIKey(ctx context.Context, key string) (*domain.JWTCustomClaims, error)
+	GetOAuthClient(ctx context.Context, clientID string) (*domain.OAuthClient, error)
 }
 type AuthService interface {
-	GetUserTokenByID(tokenID string) (string, error)
-	GetUserByID(userID string) (*domain.User, error)
+	ParseAccessToken(ctx context.Context, accessToken string) (*domain.JWTCustomClaims, error)
+	GetUserTokenByID(ctx context.Context, tokenID string) (string, error)
+	GetUserByID(ctx context.Context, userID string) (*domain.User, error)
+	GetUserPermissions(ctx context.Context, userID string) ([]string, error)
+	AuthenticateAPIKey(ctx context.Context, key string) (*domain.JWTCustomClaims, error)
+	GetOAuthClient(ctx context.Context, clientID string) (*domain.OAuthClient, error)
+}
+
+type MFARepository interface {
+	EnrollTOTP(ctx context.Context, userID string) (*domain.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, userID, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, userID, code string) error
+	ConsumeMFAChallenge(ctx context.Context, mfaToken string) (*domain.User, error)
+	CompleteMFALogin(ctx context.Context, user *domain.User, code string, client domain.ClientInfo) (*domain.LoginResponse, error)
+}
+type MFAService interface {
+	EnrollTOTP(ctx context.Context, userID string) (*domain.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, userID, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, userID, code string) error
+	VerifyMFA(ctx context.Context, mfaToken, code string, client domain.ClientInfo) (*domain.LoginResponse, error)
+}
+
+type PasskeyRepository interface {
+	BeginPasskeyRegistration(ctx context.Context, userID string) (*domain.PublicKeyCredentialCreationOptions, error)
+	FinishPasskeyRegistration(ctx context.Context, userID, name string, credential *domain.RegistrationCredential) (*domain.WebAuthnCredential, error)
+	BeginPasskeyLogin(ctx context.Context) (*domain.PublicKeyCredentialRequestOptions, error)
+	FinishPasskeyLogin(ctx context.Context, credential *domain.AssertionCredential, client domain.ClientInfo) (*domain.LoginResponse, error)
+}
+type PasskeyService interface {
+	BeginPasskeyRegistration(ctx context.Context, userID string) (*domain.PublicKeyCredentialCreationOptions, error)
+	FinishPasskeyRegistration(ctx context.Context, userID, name string, credential *domain.RegistrationCredential) (*domain.WebAuthnCredential, error)
+	BeginPasskeyLogin(ctx context.Context) (*domain.PublicKeyCredentialRequestOptions, error)
+	FinishPasskeyLogin(ctx context.Context, credential *domain.AssertionCredential, client domain.ClientInfo) (*domain.LoginResponse, error)
+}
+
+type OAuthRepository interface {
+	CreateOAuthClient(ctx context.Context, ownerID string, req *domain.CreateOAuthClientRequest) (*domain.OAuthClient, string, error)
+	Authorize(ctx context.Context, userID, sessionID string, req *domain.AuthorizationRequest) (*domain.AuthorizationResult, error)
+	ExchangeToken(ctx context.Context, req *domain.TokenRequest, client domain.ClientInfo) (*domain.TokenResponse, error)
+	IntrospectToken(ctx context.Context, req *domain.IntrospectionRequest) (*domain.IntrospectionResponse, error)
+	RevokeToken(ctx context.Context, req *domain.RevocationRequest) error
+}
+type OAuthService interface {
+	CreateOAuthClient(ctx context.Context, ownerID string, req *domain.CreateOAuthClientRequest) (*domain.OAuthClient, string, error)
+	Authorize(ctx context.Context, userID, sessionID string, req *domain.AuthorizationRequest) (*domain.AuthorizationResult, error)
+	ExchangeToken(ctx context.Context, req *domain.TokenRequest, client domain.ClientInfo) (*domain.TokenResponse, error)
+	IntrospectToken(ctx context.Context, req *domain.IntrospectionRequest) (*domain.IntrospectionResponse, error)
+	RevokeToken(ctx context.Context, req *domain.RevocationRequest) error
+}
+
+type OIDCRepository interface {
+	OpenIDConfiguration(ctx context.Context) (*domain.OpenIDConfiguration, error)
+	JWKS(ctx context.Context) (*domain.JSONWebKeySet, error)
+	UserInfo(ctx context.Context, userID, scope string) (*domain.UserInfo, error)
+}
+type OIDCService interface {
+	OpenIDConfiguration(ctx context.Context) (*domain.OpenIDConfiguration, error)
+	JWKS(ctx context.Context) (*domain.JSONWebKeySet, error)
+	UserInfo(ctx context.Context, userID, scope string) (*domain.UserInfo, error)
+}
+
+type SessionRepository interface {
+	ListSessions(ctx context.Context, userID, currentSessionID string) ([]*domain.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID string) error
+	RevokeOtherSessions(ctx context.Context, userID, currentSessionID string) error
+}
+type SessionService interface {
+	ListSessions(ctx context.Context, userID, currentSessionID string) ([]*domain.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID string) error
+	RevokeOtherSessions(ctx context.Context, userID, currentSessionID string) error
+}
+
+type RoleRepository interface {
+	ListRoles(ctx context.Context) ([]*domain.Role, error)
+	GetUserRoles(ctx context.Context, userID string) ([]*domain.Role, error)
+	AssignRole(ctx context.Context, userID, roleName string) error
+	RemoveRole(ctx context.Context, userID, roleName string) error
+}
+type RoleService interface {
+	ListRoles(ctx context.Context) ([]*domain.Role, error)
+	GetUserRoles(ctx context.Context, userID string) ([]*domain.Role, error)
+	AssignRole(ctx context.Context, userID, roleName string) error
+	RemoveRole(ctx context.Context, userID, roleName string) error
+}
+
+type APIKeyRepository interface {
+	CreateServiceAccount(ctx context.Context, username string) (*domain.User, error)
+	CreateAPIKey(ctx context.Context, creatorID, serviceAccountID, name string, scopes []string, expiresAt *time.Time) (*domain.CreateAPIKeyResponse, error)
+	ListAPIKeys(ctx context.Context, serviceAccountID string) ([]*domain.APIKey, error)
+	RevokeAPIKey(ctx context.Context, apiKeyID string) error
+}
+type APIKeyService interface {
+	CreateServiceAccount(ctx context.Context, username string) (*domain.User, error)
+	CreateAPIKey(ctx context.Context, creatorID, serviceAccountID, name string, scopes []string, expiresAt *time.Time) (*domain.CreateAPIKeyResponse, error)
+	ListAPIKeys(ctx context.Context, serviceAccountID string) ([]*domain.APIKey, error)
+	RevokeAPIKey(ctx context.Context, apiKeyID string) error
 }
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"context"
+	"go-chat/internals/core/domain"
+	"go-chat/internals/core/ports"
+	"time"
+)
+
+type APIKeyService struct {
+	repo ports.APIKeyRepository
+}
+
+func NewAPIKeyService(repo ports.APIKeyRepository) *APIKeyService {
+	return &APIKeyService{
+		repo: repo,
+	}
+}
+
+func (k *APIKeyService) CreateServiceAccount(ctx context.Context, username string) (*domain.User, error) {
+	return k.repo.CreateServiceAccount(ctx, username)
+}
+
+func (k *APIKeyService) CreateAPIKey(ctx context.Context, creatorID, serviceAccountID, name string, scopes []string, expiresAt *time.Time) (*domain.CreateAPIKeyResponse, error) {
+	return k.repo.CreateAPIKey(ctx, creatorID, serviceAccountID, name, scopes, expiresAt)
+}
+
+func (k *APIKeyService) ListAPIKeys(ctx context.Context, serviceAccountID string) ([]*domain.APIKey, error) {
+	return k.repo.ListAPIKeys(ctx, serviceAccountID)
+}
+
+func (k *APIKeyService) RevokeAPIKey(ctx context.Context, apiKeyID string) error {
+	return k.repo.RevokeAPIKey(ctx, apiKeyID)
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-chat/internals/core/domain"
+	"go-chat/internals/core/ports"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AuditService struct {
+	sink ports.AuditSink
+	repo ports.AuditRepository
+}
+
+func NewAuditService(sink ports.AuditSink, repo ports.AuditRepository) *AuditService {
+	return &AuditService{
+		sink: sink,
+		repo: repo,
+	}
+}
+
+// Record stamps the event and writes it to the sink. A failure to write is
+// logged rather than returned so it never fails the request being audited.
+// The write outlives a cancelled request, so the event is not lost when the
+// client disconnects.
+func (a *AuditService) Record(ctx context.Context, event *domain.AuditEvent) {
+	event.ID = uuid.New()
+	event.CreatedAt = time.Now().UTC()
+	event.UpdatedAt = event.CreatedAt
+
+	if err := a.sink.Write(context.WithoutCancel(ctx), event); err != nil {
+		log.Printf("failed to write %s audit event: %v", event.Type, err)
+	}
+}
+
+// auditRefreshTokenReuse records a replayed refresh token if err reports one.
+// Like a lockout, no handler sees it as more than a failed refresh.
+func auditRefreshTokenReuse(ctx context.Context, audit ports.AuditService, err error, client domain.ClientInfo) {
+	var reuse *domain.RefreshTokenReuseError
+	if !errors.As(err, &reuse) {
+		return
+	}
+
+	audit.Record(ctx, &domain.AuditEvent{
+		Type:      domain.AuditEventRefreshTokenReuse,
+		TargetID:  reuse.UserID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Outcome:   domain.AuditOutcomeSuccess,
+		Details:   fmt.Sprintf("token %s presented after rotation, family %s revoked", reuse.TokenID, reuse.FamilyID),
+	})
+}
+
+func (a *AuditService) ListAuditEvents(ctx context.Context, filter *domain.AuditFilter) (*domain.AuditPage, error) {
+	return a.repo.ListAuditEvents(ctx, filter)
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"go-chat/internals/core/domain"
 	"go-chat/internals/core/ports"
 )
@@ -15,10 +16,26 @@ func NewAuthService(repo ports.AuthRepository) *AuthService {
 	}
 }
 
-func (a *AuthService) GetUserTokenByID(tokenID string) (string, error) {
-	return a.repo.GetUserTokenByID(tokenID)
+func (a *AuthService) ParseAccessToken(ctx context.Context, accessToken string) (*domain.JWTCustomClaims, error) {
+	return a.repo.ParseAccessToken(ctx, accessToken)
 }
 
-func (a *AuthService) GetUserByID(userID string) (*domain.User, error) {
-	return a.repo.GetUserByID(userID)
+func (a *AuthService) GetUserTokenByID(ctx context.Context, tokenID string) (string, error) {
+	return a.repo.GetUserTokenByID(ctx, tokenID)
+}
+
+func (a *AuthService) GetUserByID(ctx context.Context, userID string) (*domain.User, error) {
+	return a.repo.GetUserByID(ctx, userID)
+}
+
+func (a *AuthService) GetUserPermissions(ctx context.Context, userID string) ([]string, error) {
+	return a.repo.GetUserPermissions(ctx, userID)
+}
+
+func (a *AuthService) AuthenticateAPIKey(ctx context.Context, key string) (*domain.JWTCustomClaims, error) {
+	return a.repo.AuthenticateAPIKey(ctx, key)
+}
+
+func (a *AuthService) GetOAuthClient(ctx context.Context, clientID string) (*domain.OAuthClient, error) {
+	return a.repo.GetOAuthClient(ctx, clientID)
 }
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"go-chat/internals/core/domain"
 	"go-chat/internals/core/ports"
 )
@@ -15,10 +16,26 @@ func NewBookService(repo ports.BookRepository) *BookService {
 	}
 }
 
-func (b *BookService) GetBooks() ([]*domain.Book, error) {
-	return b.repo.GetBooks()
+func (b *BookService) GetBooks(ctx context.Context, filter *domain.BookFilter) (*domain.BookPage, error) {
+	return b.repo.GetBooks(ctx, filter)
 }
 
-func (b *BookService) CreateBook(title string) (*domain.Book, error) {
-	return b.repo.CreateBook(title)
+func (b *BookService) GetBook(ctx context.Context, id string) (*domain.Book, error) {
+	return b.repo.GetBook(ctx, id)
+}
+
+func (b *BookService) CreateBook(ctx context.Context, title string) (*domain.Book, error) {
+	return b.repo.CreateBook(ctx, title)
+}
+
+func (b *BookService) UpdateBook(ctx context.Context, id string, update *domain.BookUpdate) (*domain.Book, error) {
+	return b.repo.UpdateBook(ctx, id, update)
+}
+
+func (b *BookService) DeleteBook(ctx context.Context, id string) error {
+	return b.repo.DeleteBook(ctx, id)
+}
+
+func (b *BookService) RestoreBook(ctx context.Context, id string) (*domain.Book, error) {
+	return b.repo.RestoreBook(ctx, id)
 }
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"go-chat/internals/core/domain"
+	"go-chat/internals/core/ports"
+	"log"
+)
+
+type MFAService struct {
+	repo    ports.MFARepository
+	limiter ports.LoginLimiter
+	audit   ports.AuditService
+}
+
+func NewMFAService(repo ports.MFARepository, limiter ports.LoginLimiter, audit ports.AuditService) *MFAService {
+	return &MFAService{
+		repo:    repo,
+		limiter: limiter,
+		audit:   audit,
+	}
+}
+
+func (m *MFAService) EnrollTOTP(ctx context.Context, userID string) (*domain.TOTPEnrollment, error) {
+	return m.repo.EnrollTOTP(ctx, userID)
+}
+
+func (m *MFAService) ConfirmTOTP(ctx context.Context, userID, code string) ([]string, error) {
+	return m.repo.ConfirmTOTP(ctx, userID, code)
+}
+
+func (m *MFAService) DisableTOTP(ctx context.Context, userID, code string) error {
+	return m.repo.DisableTOTP(ctx, userID, code)
+}
+
+// VerifyMFA completes a login that LoginUser answered with a challenge. Wrong
+// codes count as failed logins of the account, like wrong passwords, so the
+// password alone does not allow unlimited guesses at the second factor.
+func (m *MFAService) VerifyMFA(ctx context.Context, mfaToken, code string, client domain.ClientInfo) (*domain.LoginResponse, error) {
+	user, err := m.repo.ConsumeMFAChallenge(ctx, mfaToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.limiter.Check(ctx, user.Email, client.IP); err != nil {
+		return nil, err
+	}
+
+	response, err := m.repo.CompleteMFALogin(ctx, user, code, client)
+	if errors.Is(err, domain.ErrMFACodeInvalid) {
+		lockedUntil, locked, limitErr := m.limiter.RecordFailure(ctx, user.Email, client.IP)
+		if limitErr != nil {
+			log.Printf("failed to record login failure for %s: %v", user.Email, limitErr)
+		}
+		if locked {
+			auditLockout(ctx, m.audit, user.ID.String(), user.Email, client, lockedUntil)
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.limiter.Reset(ctx, user.Email); err != nil {
+		log.Printf("failed to reset login failures for %s: %v", user.Email, err)
+	}
+
+	return response, nil
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"go-chat/internals/core/domain"
+	"go-chat/internals/core/ports"
+)
+
+type OAuthService struct {
+	repo  ports.OAuthRepository
+	audit ports.AuditService
+}
+
+func NewOAuthService(repo ports.OAuthRepository, audit ports.AuditService) *OAuthService {
+	return &OAuthService{
+		repo:  repo,
+		audit: audit,
+	}
+}
+
+func (o *OAuthService) CreateOAuthClient(ctx context.Context, ownerID string, req *domain.CreateOAuthClientRequest) (*domain.OAuthClient, string, error) {
+	return o.repo.CreateOAuthClient(ctx, ownerID, req)
+}
+
+func (o *OAuthService) Authorize(ctx context.Context, userID, sessionID string, req *domain.AuthorizationRequest) (*domain.AuthorizationResult, error) {
+	return o.repo.Authorize(ctx, userID, sessionID, req)
+}
+
+func (o *OAuthService) ExchangeToken(ctx context.Context, req *domain.TokenRequest, client domain.ClientInfo) (*domain.TokenResponse, error) {
+	tokens, err := o.repo.ExchangeToken(ctx, req, client)
+	auditRefreshTokenReuse(ctx, o.audit, err, client)
+	return tokens, err
+}
+
+func (o *OAuthService) IntrospectToken(ctx context.Context, req *domain.IntrospectionRequest) (*domain.IntrospectionResponse, error) {
+	return o.repo.IntrospectToken(ctx, req)
+}
+
+func (o *OAuthService) RevokeToken(ctx context.Context, req *domain.RevocationRequest) error {
+	return o.repo.RevokeToken(ctx, req)
+}
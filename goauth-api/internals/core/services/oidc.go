@@ -0,0 +1,29 @@
+package services
+
+import (
+	"context"
+	"go-chat/internals/core/domain"
+	"go-chat/internals/core/ports"
+)
+
+type OIDCService struct {
+	repo ports.OIDCRepository
+}
+
+func NewOIDCService(repo ports.OIDCRepository) *OIDCService {
+	return &OIDCService{
+		repo: repo,
+	}
+}
+
+func (o *OIDCService) OpenIDConfiguration(ctx context.Context) (*domain.OpenIDConfiguration, error) {
+	return o.repo.OpenIDConfiguration(ctx)
+}
+
+func (o *OIDCService) JWKS(ctx context.Context) (*domain.JSONWebKeySet, error) {
+	return o.repo.JWKS(ctx)
+}
+
+func (o *OIDCService) UserInfo(ctx context.Context, userID, scope string) (*domain.UserInfo, error) {
+	return o.repo.UserInfo(ctx, userID, scope)
+}
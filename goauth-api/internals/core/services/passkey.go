@@ -0,0 +1,33 @@
+package services
+
+import (
+	"context"
+	"go-chat/internals/core/domain"
+	"go-chat/internals/core/ports"
+)
+
+type PasskeyService struct {
+	repo ports.PasskeyRepository
+}
+
+func NewPasskeyService(repo ports.PasskeyRepository) *PasskeyService {
+	return &PasskeyService{
+		repo: repo,
+	}
+}
+
+func (p *PasskeyService) BeginPasskeyRegistration(ctx context.Context, userID string) (*domain.PublicKeyCredentialCreationOptions, error) {
+	return p.repo.BeginPasskeyRegistration(ctx, userID)
+}
+
+func (p *PasskeyService) FinishPasskeyRegistration(ctx context.Context, userID, name string, credential *domain.RegistrationCredential) (*domain.WebAuthnCredential, error) {
+	return p.repo.FinishPasskeyRegistration(ctx, userID, name, credential)
+}
+
+func (p *PasskeyService) BeginPasskeyLogin(ctx context.Context) (*domain.PublicKeyCredentialRequestOptions, error) {
+	return p.repo.BeginPasskeyLogin(ctx)
+}
+
+func (p *PasskeyService) FinishPasskeyLogin(ctx context.Context, credential *domain.AssertionCredential, client domain.ClientInfo) (*domain.LoginResponse, error) {
+	return p.repo.FinishPasskeyLogin(ctx, credential, client)
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"context"
+	"go-chat/internals/core/domain"
+	"go-chat/internals/core/ports"
+)
+
+type RoleService struct {
+	repo ports.RoleRepository
+}
+
+func NewRoleService(repo ports.RoleRepository) *RoleService {
+	return &RoleService{
+		repo: repo,
+	}
+}
+
+func (r *RoleService) ListRoles(ctx context.Context) ([]*domain.Role, error) {
+	return r.repo.ListRoles(ctx)
+}
+
+func (r *RoleService) GetUserRoles(ctx context.Context, userID string) ([]*domain.Role, error) {
+	return r.repo.GetUserRoles(ctx, userID)
+}
+
+func (r *RoleService) AssignRole(ctx context.Context, userID, roleName string) error {
+	return r.repo.AssignRole(ctx, userID, roleName)
+}
+
+func (r *RoleService) RemoveRole(ctx context.Context, userID, roleName string) error {
+	return r.repo.RemoveRole(ctx, userID, roleName)
+}
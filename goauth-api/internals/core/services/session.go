@@ -0,0 +1,29 @@
+package services
+
+import (
+	"context"
+	"go-chat/internals/core/domain"
+	"go-chat/internals/core/ports"
+)
+
+type SessionService struct {
+	repo ports.SessionRepository
+}
+
+func NewSessionService(repo ports.SessionRepository) *SessionService {
+	return &SessionService{
+		repo: repo,
+	}
+}
+
+func (s *SessionService) ListSessions(ctx context.Context, userID, currentSessionID string) ([]*domain.Session, error) {
+	return s.repo.ListSessions(ctx, userID, currentSessionID)
+}
+
+func (s *SessionService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	return s.repo.RevokeSession(ctx, userID, sessionID)
+}
+
+func (s *SessionService) RevokeOtherSessions(ctx context.Context, userID, currentSessionID string) error {
+	return s.repo.RevokeOtherSessions(ctx, userID, currentSessionID)
+}
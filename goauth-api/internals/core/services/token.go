@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"go-chat/internals/core/ports"
 	"time"
 )
@@ -15,10 +16,10 @@ func NewTokenService(repo ports.TokenRepository) *TokenService {
 	}
 }
 
-func (t *TokenService) SetRefreshToken(userID string, tokenID string, expiresIn time.Duration) error {
-	return t.repo.SetRefreshToken(userID, tokenID, expiresIn)
+func (t *TokenService) SetRefreshToken(ctx context.Context, userID string, tokenID string, expiresIn time.Duration) error {
+	return t.repo.SetRefreshToken(ctx, userID, tokenID, expiresIn)
 }
 
-func (t *TokenService) DeleteRefreshToken(userID string, prevTokenID string) error {
-	return t.repo.DeleteRefreshToken(userID, prevTokenID)
+func (t *TokenService) DeleteRefreshToken(ctx context.Context, userID string, prevTokenID string) error {
+	return t.repo.DeleteRefreshToken(ctx, userID, prevTokenID)
 }
@@ -1,36 +1,221 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"go-chat/internals/core/domain"
 	"go-chat/internals/core/ports"
+	"log"
+	"time"
 )
 
 type UserService struct {
-	repo ports.UserRepository
+	repo    ports.UserRepository
+	mailer  ports.Mailer
+	limiter ports.LoginLimiter
+	audit   ports.AuditService
 }
 
-func NewUserService(repo ports.UserRepository) *UserService {
+func NewUserService(repo ports.UserRepository, mailer ports.Mailer, limiter ports.LoginLimiter, audit ports.AuditService) *UserService {
 	return &UserService{
-		repo: repo,
+		repo:    repo,
+		mailer:  mailer,
+		limiter: limiter,
+		audit:   audit,
 	}
 }
 
-func (u *UserService) CreateUser(email, username, password string) (*domain.User, error) {
-	return u.repo.CreateUser(email, username, password)
+func (u *UserService) CreateUser(ctx context.Context, email, username, password string) (*domain.User, error) {
+	user, err := u.repo.CreateUser(ctx, email, username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	// The account already exists at this point; a failed mail can be retried through ResendVerification.
+	if err := u.sendVerificationEmail(ctx, user); err != nil {
+		log.Printf("failed to send verification email to user %s: %v", user.ID, err)
+	}
+
+	return user, nil
+}
+
+// RegisterPrivately creates the account like CreateUser, but its result does not
+// reveal whether the email or username was already taken. Whoever controls the
+// email address is told by mail instead, so only they learn about the conflict.
+func (u *UserService) RegisterPrivately(ctx context.Context, email, username, password string) error {
+	_, err := u.CreateUser(ctx, email, username, password)
+	switch {
+	case errors.Is(err, domain.ErrEmailTaken):
+		u.sendRegistrationNotice(ctx, email, "Someone tried to register with your email address",
+			"Someone tried to create a new account with this email address, which already has one.\n\n"+
+				"If it was you, log in instead, or reset your password if you have forgotten it. Otherwise you can ignore this email.\n")
+		return nil
+	case errors.Is(err, domain.ErrUsernameTaken):
+		u.sendRegistrationNotice(ctx, email, "Choose another username",
+			fmt.Sprintf("The username %s is already taken, so no account was created for this email address.\n\n"+
+				"Register again with another username. If you did not try to register, you can ignore this email.\n", username))
+		return nil
+	}
+
+	return err
+}
+
+// sendRegistrationNotice mails the outcome of a private registration. A failure is only
+// logged, like a failed verification mail, so it cannot be told apart from a success.
+func (u *UserService) sendRegistrationNotice(ctx context.Context, email, subject, body string) {
+	if err := u.mailer.Send(ctx, email, subject, body); err != nil {
+		log.Printf("failed to send registration notice to %s: %v", email, err)
+	}
+}
+
+func (u *UserService) LoginUser(ctx context.Context, email, password string, client domain.ClientInfo) (*domain.LoginResponse, error) {
+	if err := u.limiter.Check(ctx, email, client.IP); err != nil {
+		return nil, err
+	}
+
+	response, err := u.repo.LoginUser(ctx, email, password, client)
+	if errors.Is(err, domain.ErrInvalidCredentials) {
+		lockedUntil, locked, limitErr := u.limiter.RecordFailure(ctx, email, client.IP)
+		if limitErr != nil {
+			log.Printf("failed to record login failure for %s: %v", email, limitErr)
+		}
+		if locked {
+			u.recordLockout(ctx, email, client, lockedUntil)
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// With MFA enabled the password alone proves nothing yet; the failures
+	// are kept until the second factor checks out, see MFAService.VerifyMFA.
+	if response.MFARequired {
+		return response, nil
+	}
+
+	if err := u.limiter.Reset(ctx, email); err != nil {
+		log.Printf("failed to reset login failures for %s: %v", email, err)
+	}
+
+	return response, nil
+}
+
+// UnlockAccount lifts a lockout before it expires.
+func (u *UserService) UnlockAccount(ctx context.Context, userID string) error {
+	user, err := u.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return u.limiter.Unlock(ctx, user.Email)
+}
+
+func (u *UserService) recordLockout(ctx context.Context, email string, client domain.ClientInfo, lockedUntil time.Time) {
+	target := email
+	if user, err := u.repo.GetUserByEmail(ctx, email); err == nil {
+		target = user.ID.String()
+	}
+
+	auditLockout(ctx, u.audit, target, email, client, lockedUntil)
+}
+
+// auditLockout records a lockout. No handler sees it happen, since the
+// attempt that causes it fails like any other wrong password or code.
+func auditLockout(ctx context.Context, audit ports.AuditService, target, email string, client domain.ClientInfo, lockedUntil time.Time) {
+	audit.Record(ctx, &domain.AuditEvent{
+		Type:      domain.AuditEventAccountLockout,
+		TargetID:  target,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Outcome:   domain.AuditOutcomeSuccess,
+		Details:   fmt.Sprintf("account %s locked until %s after failed logins", email, lockedUntil.Format(time.RFC3339)),
+	})
+}
+
+func (u *UserService) LogoutUser(ctx context.Context, refreshToken string) (string, error) {
+	return u.repo.LogoutUser(ctx, refreshToken)
+}
+
+func (u *UserService) GetUserByUsername(ctx context.Context, username string) (*domain.User, error) {
+	return u.repo.GetUserByUsername(ctx, username)
 }
 
-func (u *UserService) LoginUser(email, password string) (*domain.LoginResponse, error) {
-	return u.repo.LoginUser(email, password)
+func (u *UserService) RefreshTokens(ctx context.Context, refreshToken string, client domain.ClientInfo) (*domain.LoginResponse, error) {
+	tokens, err := u.repo.RefreshTokens(ctx, refreshToken, client)
+	auditRefreshTokenReuse(ctx, u.audit, err, client)
+	return tokens, err
 }
 
-func (u *UserService) LogoutUser(refreshToken string) error {
-	return u.repo.LogoutUser(refreshToken)
+func (u *UserService) VerifyEmail(ctx context.Context, token string) error {
+	_, err := u.repo.VerifyEmail(ctx, token)
+	return err
 }
 
-func (u *UserService) GetUserByUsername(username string) (*domain.User, error) {
-	return u.repo.GetUserByUsername(username)
+// ResendVerification returns before looking the email up, so neither its
+// response nor its timing reveals whether the account exists.
+func (u *UserService) ResendVerification(ctx context.Context, email string) {
+	u.inBackground(ctx, "resend verification email", func(ctx context.Context) error {
+		user, err := u.repo.GetUserByEmail(ctx, email)
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if user.VerifiedAt != nil {
+			return nil
+		}
+
+		return u.sendVerificationEmail(ctx, user)
+	})
+}
+
+// ForgotPassword returns before looking the email up, so neither its response
+// nor its timing reveals whether the account exists.
+func (u *UserService) ForgotPassword(ctx context.Context, email string) {
+	u.inBackground(ctx, "send password reset email", func(ctx context.Context) error {
+		user, err := u.repo.GetUserByEmail(ctx, email)
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		token, err := u.repo.CreatePasswordResetToken(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		body := fmt.Sprintf("Hi %s,\n\nUse the following token to reset your password:\n\n%s\n\nIf you did not request a password reset, you can ignore this email.\n", user.Username, token)
+		return u.mailer.Send(ctx, user.Email, "Reset your password", body)
+	})
 }
 
-func (u *UserService) RefreshTokens(refreshToken string) (*domain.LoginResponse, error) {
-	return u.repo.RefreshTokens(refreshToken)
+// inBackground runs fn after the request has been answered and logs its error,
+// which the caller must not see. fn keeps the values of ctx but not its cancellation.
+func (u *UserService) inBackground(ctx context.Context, what string, fn func(ctx context.Context) error) {
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := fn(ctx); err != nil {
+			log.Printf("failed to %s: %v", what, err)
+		}
+	}()
+}
+
+func (u *UserService) ResetPassword(ctx context.Context, token, newPassword string) (*domain.User, error) {
+	return u.repo.ResetPassword(ctx, token, newPassword)
+}
+
+func (u *UserService) sendVerificationEmail(ctx context.Context, user *domain.User) error {
+	token, err := u.repo.CreateEmailVerificationToken(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nUse the following token to verify your email address:\n\n%s\n", user.Username, token)
+	return u.mailer.Send(ctx, user.Email, "Verify your email address", body)
 }